@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/models"
+)
+
+// Development credentials of the sample application
+const (
+	devApplicationID = "00000000-0000-0000-0000-000000000001"
+	devClientID      = "test_client"
+	devClientSecret  = "test_secret"
+)
+
+// newDevDatabase creates an in-memory database holding the sample application
+func newDevDatabase() (*db.MemoryDB, error) {
+	database := db.NewMemoryDB()
+
+	err := database.CreateApplication(context.Background(), &models.Application{
+		ID:           devApplicationID,
+		ClientID:     devClientID,
+		ClientSecret: devClientSecret,
+		Enabled:      true,
+		PlanTier:     models.PlanTierFree,
+		AuthMode:     models.AuthModeSecret,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return database, nil
+}
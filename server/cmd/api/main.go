@@ -2,71 +2,136 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kevinmahoney/etrenank/internal/api"
 	"github.com/kevinmahoney/etrenank/internal/config"
 	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/lifecycle"
+	"github.com/kevinmahoney/etrenank/internal/logging"
 	"github.com/kevinmahoney/etrenank/internal/services/cache"
+	"github.com/kevinmahoney/etrenank/internal/settings"
+	"github.com/kevinmahoney/etrenank/internal/tracing"
 )
 
 func main() {
+	dev := flag.Bool("dev", false, "run without Postgres or Redis, using in-memory storage and a sample application")
+	configPath := flag.String("config", os.Getenv(config.FileEnv), "path of a YAML or TOML config file, whose settings are overridden by environment variables")
+	flag.Parse()
+
 	// Load environment variables from .env file
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
 	}
 
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.Load(*configPath)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Initialize database connection
-	database, err := db.NewPostgresDB(cfg.Database)
+	// Initialize structured logging, redacting secrets from every log line
+	if _, err := logging.Setup(os.Stdout, cfg.Log, cfg.Weather.APIKey, cfg.Database.Password, cfg.Redis.Password, cfg.Admin.APIKey); err != nil {
+		log.Fatalf("Failed to initialize logging: %v", err)
+	}
+
+	if err := run(cfg, *dev); err != nil {
+		slog.Error("Server exited with an error", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Server exited properly")
+}
+
+// run starts every component of the server and runs them until SIGINT or
+// SIGTERM, then stops them in the reverse order. Components started before
+// a startup failure are stopped too.
+func run(cfg *config.Config, dev bool) error {
+	components := lifecycle.NewManager()
+	defer components.Stop()
+
+	// Initialize tracing, which is stopped last to flush the spans of the shutdown
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return fmt.Errorf("failed to initialize tracing: %v", err)
 	}
-	defer database.Close()
+	components.Add(lifecycle.Component{Name: "tracing", Stop: shutdownTracing, Timeout: cfg.Shutdown.CloseTimeout})
 
-	// Initialize Redis cache
-	redisClient, err := cache.NewRedisClient(cfg.Redis)
+	// Initialize database connection, or an in-memory database in development mode
+	var database db.Repository
+	if dev {
+		slog.Info("Development mode: using in-memory database and cache", "client_id", devClientID)
+		cfg.Cache.Backend = cache.BackendMemory
+		database, err = newDevDatabase()
+	} else {
+		database, err = openDatabase(cfg.Database)
+	}
 	if err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		return fmt.Errorf("failed to connect to database: %v", err)
 	}
-	defer redisClient.Close()
+	components.Add(lifecycle.Component{
+		Name:    "database",
+		Stop:    func(context.Context) error { return database.Close() },
+		Timeout: cfg.Shutdown.CloseTimeout,
+	})
 
-	// Create API server
-	server := api.NewServer(cfg, database, redisClient)
+	// Initialize cache store
+	cacheStore, err := cache.NewStore(cfg.Cache, cfg.Redis)
+	if err != nil {
+		return fmt.Errorf("failed to initialize cache: %v", err)
+	}
+	components.Add(lifecycle.Component{
+		Name:    "cache_store",
+		Stop:    func(context.Context) error { return cacheStore.Close() },
+		Timeout: cfg.Shutdown.CloseTimeout,
+	})
 
-	// Start server in a goroutine
-	go func() {
-		if err := server.Start(); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
-		}
-	}()
+	// Load runtime settings, which are reloaded while the server runs
+	runtimeSettings, err := settings.NewManager(cfg.Runtime, database)
+	if err != nil {
+		return fmt.Errorf("failed to load runtime settings: %v", err)
+	}
 
-	log.Printf("Server started on %s", cfg.Server.Address)
+	// Create API server
+	server := api.NewServer(cfg, database, cacheStore, runtimeSettings)
+	for _, component := range server.Components() {
+		components.Add(component)
+	}
 
-	// Wait for interrupt signal to gracefully shut down the server
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// Run until interrupted. Once shutting down, the signals are no longer
+	// caught, so that a second one exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
 
-	log.Println("Shutting down server...")
+	slog.Info("Server started", "address", cfg.Server.Address)
+	return components.Run(ctx)
+}
 
-	// Create a deadline for server shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// openDatabase connects to Postgres and applies pending migrations if enabled
+func openDatabase(cfg config.DatabaseConfig) (*db.PostgresDB, error) {
+	database, err := db.NewPostgresDB(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	if cfg.AutoMigrate {
+		applied, err := database.MigrateUp(context.Background())
+		if err != nil {
+			database.Close()
+			return nil, fmt.Errorf("failed to migrate database: %v", err)
+		}
+		if applied > 0 {
+			slog.Info("Applied database migrations", "count", applied)
+		}
 	}
 
-	log.Println("Server exited properly")
+	return database, nil
 }
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/credentials"
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/models"
+)
+
+// runCreate creates a new application with a generated secret
+func runCreate(ctx context.Context, cfg *config.Config, database *db.PostgresDB, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	clientID := flags.String("client-id", "", "client ID of the new application")
+	authMode := flags.String("auth-mode", models.AuthModeSecret, "how the application authenticates: secret or hmac")
+	ownerEmail := flags.String("owner-email", "", "contact email of the application owner")
+	planTier := flags.String("plan-tier", models.PlanTierFree, "plan tier: free, pro or enterprise")
+	expiresAt := flags.String("expires-at", "", "RFC 3339 time after which the application stops working")
+	flags.Parse(args)
+
+	if *clientID == "" {
+		return errors.New("-client-id is required")
+	}
+	if *authMode != models.AuthModeSecret && *authMode != models.AuthModeHMAC {
+		return fmt.Errorf("unknown auth mode %q", *authMode)
+	}
+	switch *planTier {
+	case models.PlanTierFree, models.PlanTierPro, models.PlanTierEnterprise:
+	default:
+		return fmt.Errorf("unknown plan tier %q", *planTier)
+	}
+
+	var expiry *time.Time
+	if *expiresAt != "" {
+		t, err := time.Parse(time.RFC3339, *expiresAt)
+		if err != nil {
+			return fmt.Errorf("invalid -expires-at: %v", err)
+		}
+		expiry = &t
+	}
+
+	id, err := credentials.NewUUID()
+	if err != nil {
+		return err
+	}
+
+	secret, err := credentials.NewSecret()
+	if err != nil {
+		return err
+	}
+
+	app := &models.Application{
+		ID:           id,
+		ClientID:     *clientID,
+		ClientSecret: secret,
+		Enabled:      true,
+		ExpiresAt:    expiry,
+		OwnerEmail:   *ownerEmail,
+		PlanTier:     *planTier,
+		AuthMode:     *authMode,
+	}
+	if err := database.CreateApplication(ctx, app); err != nil {
+		return err
+	}
+
+	fmt.Printf("ID:            %s\n", app.ID)
+	fmt.Printf("Client ID:     %s\n", app.ClientID)
+	fmt.Printf("Client secret: %s\n", app.ClientSecret)
+	fmt.Println("\nStore the client secret now, it cannot be shown again.")
+	return nil
+}
+
+// runList lists all applications
+func runList(ctx context.Context, cfg *config.Config, database *db.PostgresDB, args []string) error {
+	apps, err := database.ListApplications(ctx, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCLIENT ID\tOWNER\tTIER\tAUTH MODE\tSTATUS\tEXPIRES\tLAST USED")
+	for _, app := range apps {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			app.ID, app.ClientID, app.OwnerEmail, app.PlanTier, app.AuthMode, status(app),
+			formatTime(app.ExpiresAt), formatTime(app.LastUsedAt))
+	}
+	return w.Flush()
+}
+
+// runEnable enables a disabled application
+func runEnable(ctx context.Context, cfg *config.Config, database *db.PostgresDB, args []string) error {
+	return setEnabled(ctx, database, args, true)
+}
+
+// runDisable disables an application without deleting it
+func runDisable(ctx context.Context, cfg *config.Config, database *db.PostgresDB, args []string) error {
+	return setEnabled(ctx, database, args, false)
+}
+
+// runRotate generates a new secret for an application
+func runRotate(ctx context.Context, cfg *config.Config, database *db.PostgresDB, args []string) error {
+	flags := flag.NewFlagSet("rotate", flag.ExitOnError)
+	grace := flags.Duration("grace", cfg.Auth.SecretGracePeriod, "how long the previous secrets keep working")
+	flags.Parse(args)
+
+	app, err := lookupApplication(ctx, database, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	secret, err := credentials.NewSecret()
+	if err != nil {
+		return err
+	}
+
+	previousExpireAt := time.Now().Add(*grace)
+	if _, err := database.RotateApplicationSecret(ctx, app.ID, secret, previousExpireAt); err != nil {
+		return err
+	}
+
+	fmt.Printf("Client secret: %s\n", secret)
+	fmt.Printf("Previous secrets expire at %s\n", previousExpireAt.Format(time.RFC3339))
+	return nil
+}
+
+// runDelete deletes an application and all of its secrets
+func runDelete(ctx context.Context, cfg *config.Config, database *db.PostgresDB, args []string) error {
+	app, err := lookupApplication(ctx, database, args)
+	if err != nil {
+		return err
+	}
+
+	if err := database.DeleteApplication(ctx, app.ID); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted application %s\n", app.ClientID)
+	return nil
+}
+
+// runUsage shows the daily request counts of an application
+func runUsage(ctx context.Context, cfg *config.Config, database *db.PostgresDB, args []string) error {
+	flags := flag.NewFlagSet("usage", flag.ExitOnError)
+	days := flags.Int("days", 30, "number of days to show")
+	flags.Parse(args)
+
+	app, err := lookupApplication(ctx, database, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	since := time.Now().AddDate(0, 0, -(*days - 1))
+	usage, err := database.GetApplicationUsage(ctx, app.ID, since)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tREQUESTS")
+	for _, u := range usage {
+		fmt.Fprintf(w, "%s\t%d\n", u.Day.Format("2006-01-02"), u.RequestCount)
+		total += u.RequestCount
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\n", total)
+	return w.Flush()
+}
+
+// setEnabled enables or disables the application named in args
+func setEnabled(ctx context.Context, database *db.PostgresDB, args []string, enabled bool) error {
+	app, err := lookupApplication(ctx, database, args)
+	if err != nil {
+		return err
+	}
+
+	if err := database.SetApplicationEnabled(ctx, app.ID, enabled); err != nil {
+		return err
+	}
+
+	app.Enabled = enabled
+	fmt.Printf("Application %s is now %s\n", app.ClientID, status(*app))
+	return nil
+}
+
+// lookupApplication finds the application whose client ID is the single positional argument
+func lookupApplication(ctx context.Context, database *db.PostgresDB, args []string) (*models.Application, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected exactly one client ID")
+	}
+
+	app, err := database.GetApplicationByClientID(ctx, args[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("application %q not found", args[0])
+	}
+	return app, err
+}
+
+// status describes whether an application is enabled, disabled or expired
+func status(app models.Application) string {
+	switch {
+	case !app.Enabled:
+		return "disabled"
+	case app.IsExpired(time.Now()):
+		return "expired"
+	default:
+		return "enabled"
+	}
+}
+
+// formatTime formats an optional time, using "-" when it is not set
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/db"
+)
+
+// runConfig prints the effective configuration, with secrets redacted
+func runConfig(ctx context.Context, cfg *config.Config, database *db.PostgresDB, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errors.New("expected print")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+	for _, s := range cfg.Settings() {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, s.Redacted(), s.Source)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/db"
+)
+
+// command is an etrenankctl subcommand
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(ctx context.Context, cfg *config.Config, database *db.PostgresDB, args []string) error
+	// offline commands run without a database connection and get a nil database
+	offline bool
+}
+
+var commands = []command{
+	{"create", "create -client-id <id> [flags]", "Create an application with a generated secret", runCreate, false},
+	{"list", "list", "List all applications", runList, false},
+	{"enable", "enable <client-id>", "Enable a disabled application", runEnable, false},
+	{"disable", "disable <client-id>", "Disable an application without deleting it", runDisable, false},
+	{"rotate", "rotate [-grace <duration>] <client-id>", "Generate a new secret, expiring the old ones after a grace period", runRotate, false},
+	{"delete", "delete <client-id>", "Delete an application and all of its secrets", runDelete, false},
+	{"usage", "usage [-days <n>] <client-id>", "Show the daily request counts of an application", runUsage, false},
+	{"migrate", "migrate up|down [-steps <n>]|status", "Apply, revert or list the schema migrations", runMigrate, false},
+	{"settings", "settings get|put <file>", "Show or replace the runtime settings stored in the database", runSettings, false},
+	{"config", "config print", "Print the effective configuration with secrets redacted", runConfig, true},
+}
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	cmd := findCommand(os.Args[1])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", os.Args[1])
+		printUsage()
+		os.Exit(2)
+	}
+
+	// Load environment variables from .env file
+	_ = godotenv.Load()
+
+	// Load configuration. Offline commands get it even if it is invalid, so
+	// that it can be printed along with its problems.
+	cfg, err := config.LoadTools(os.Getenv(config.FileEnv))
+	if cfg == nil || (err != nil && !cmd.offline) {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	if cmd.offline {
+		if err := cmd.run(context.Background(), cfg, nil, os.Args[2:]); err != nil {
+			log.Fatalf("%s: %v", cmd.name, err)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Initialize database connection
+	database, err := db.NewPostgresDB(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	// The database is closed before exiting, which skips deferred calls
+	err = cmd.run(context.Background(), cfg, database, os.Args[2:])
+	database.Close()
+	if err != nil {
+		log.Fatalf("%s: %v", cmd.name, err)
+	}
+}
+
+// findCommand looks up a subcommand by name
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// printUsage prints the list of available subcommands
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: etrenankctl <command> [arguments]")
+	fmt.Fprintf(os.Stderr, "\nSettings are read from the environment and from the config file named by %s, if any.\n", config.FileEnv)
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-40s %s\n", cmd.usage, cmd.description)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/db"
+)
+
+// runMigrate applies, reverts or lists the schema migrations
+func runMigrate(ctx context.Context, cfg *config.Config, database *db.PostgresDB, args []string) error {
+	if len(args) < 1 {
+		return errors.New("expected up, down or status")
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migrations\n", applied)
+		return nil
+
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := flags.Int("steps", 1, "number of migrations to revert")
+		flags.Parse(args[1:])
+
+		if *steps < 1 {
+			return errors.New("steps must be at least 1")
+		}
+
+		reverted, err := database.MigrateDown(ctx, *steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %d migrations\n", reverted)
+		return nil
+
+	case "status":
+		statuses, err := database.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, formatTime(s.AppliedAt))
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unknown migrate action %q: expected up, down or status", args[0])
+	}
+}
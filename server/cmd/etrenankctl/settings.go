@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/settings"
+)
+
+// runSettings shows or replaces the runtime settings stored in the database
+func runSettings(ctx context.Context, cfg *config.Config, database *db.PostgresDB, args []string) error {
+	if len(args) < 1 {
+		return errors.New("expected get or put")
+	}
+
+	switch args[0] {
+	case "get":
+		document, err := database.GetRuntimeSettings(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			fmt.Println("No runtime settings stored")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(document)
+		return nil
+
+	case "put":
+		if len(args) != 2 {
+			return errors.New("expected the path of a YAML, JSON or TOML settings file")
+		}
+
+		format, err := settings.FormatOf(args[1])
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		document, err := settings.ToJSON(data, format)
+		if err != nil {
+			return fmt.Errorf("invalid runtime settings: %v", err)
+		}
+
+		if err := database.PutRuntimeSettings(ctx, document); err != nil {
+			return err
+		}
+		fmt.Println("Stored runtime settings; instances reading the database apply them within their poll interval")
+		return nil
+
+	default:
+		return fmt.Errorf("unknown settings action %q: expected get or put", args[0])
+	}
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinmahoney/etrenank/internal/credentials"
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// uuidPattern matches the textual form of a UUID
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ApplicationsHandler handles application management endpoints
+type ApplicationsHandler struct {
+	db db.ApplicationRepository
+}
+
+// NewApplicationsHandler creates a new applications handler
+func NewApplicationsHandler(db db.ApplicationRepository) *ApplicationsHandler {
+	return &ApplicationsHandler{
+		db: db,
+	}
+}
+
+// createApplicationRequest is the body of a create application request
+type createApplicationRequest struct {
+	ClientID           string     `json:"client_id" binding:"required"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+	OwnerEmail         string     `json:"owner_email" binding:"omitempty,email"`
+	PlanTier           string     `json:"plan_tier" binding:"omitempty,oneof=free pro enterprise"`
+	AuthMode           string     `json:"auth_mode" binding:"omitempty,oneof=secret hmac"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute" binding:"min=0"`
+	Scopes             []string   `json:"scopes"`
+}
+
+// updateApplicationRequest is the body of an update application request.
+// Omitted fields are left unchanged, and ClearExpiry removes any expiry.
+type updateApplicationRequest struct {
+	ExpiresAt          *time.Time `json:"expires_at"`
+	ClearExpiry        bool       `json:"clear_expiry"`
+	OwnerEmail         *string    `json:"owner_email" binding:"omitempty,email"`
+	PlanTier           *string    `json:"plan_tier" binding:"omitempty,oneof=free pro enterprise"`
+	AuthMode           *string    `json:"auth_mode" binding:"omitempty,oneof=secret hmac"`
+	RateLimitPerMinute *int       `json:"rate_limit_per_minute" binding:"omitempty,min=0"`
+	Scopes             *[]string  `json:"scopes"`
+}
+
+// CreateApplication creates an application with a generated secret
+func (h *ApplicationsHandler) CreateApplication(c *gin.Context) {
+	var req createApplicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	if err := validateScopes(req.Scopes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	id, err := credentials.NewUUID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate application ID",
+		})
+		return
+	}
+
+	secret, err := credentials.NewSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate client secret",
+		})
+		return
+	}
+
+	app := &models.Application{
+		ID:                 id,
+		ClientID:           req.ClientID,
+		ClientSecret:       secret,
+		Enabled:            true,
+		ExpiresAt:          req.ExpiresAt,
+		OwnerEmail:         req.OwnerEmail,
+		PlanTier:           req.PlanTier,
+		AuthMode:           req.AuthMode,
+		RateLimitPerMinute: req.RateLimitPerMinute,
+		Scopes:             req.Scopes,
+	}
+	if app.PlanTier == "" {
+		app.PlanTier = models.PlanTierFree
+	}
+	if app.AuthMode == "" {
+		app.AuthMode = models.AuthModeSecret
+	}
+	if app.Scopes == nil {
+		app.Scopes = []string{}
+	}
+
+	if err := h.db.CreateApplication(c.Request.Context(), app); err != nil {
+		if db.IsUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Client ID is already in use",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create application",
+		})
+		return
+	}
+
+	// The secret is only ever returned here
+	c.JSON(http.StatusCreated, app)
+}
+
+// ListApplications lists applications using limit/offset pagination
+func (h *ApplicationsHandler) ListApplications(c *gin.Context) {
+	limit, err := queryInt(c, "limit", defaultPageSize)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("limit must be between 1 and %d", maxPageSize),
+		})
+		return
+	}
+
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "offset must be a non-negative integer",
+		})
+		return
+	}
+
+	apps, err := h.db.ListApplications(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to list applications",
+		})
+		return
+	}
+
+	total, err := h.db.CountApplications(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to count applications",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"applications": apps,
+		"total":        total,
+		"limit":        limit,
+		"offset":       offset,
+	})
+}
+
+// GetApplication returns a single application
+func (h *ApplicationsHandler) GetApplication(c *gin.Context) {
+	app, ok := h.loadApplication(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, app)
+}
+
+// UpdateApplication updates the lifecycle, auth and limit settings of an application
+func (h *ApplicationsHandler) UpdateApplication(c *gin.Context) {
+	var req updateApplicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	app, ok := h.loadApplication(c)
+	if !ok {
+		return
+	}
+
+	if req.ExpiresAt != nil {
+		app.ExpiresAt = req.ExpiresAt
+	}
+	if req.ClearExpiry {
+		app.ExpiresAt = nil
+	}
+	if req.OwnerEmail != nil {
+		app.OwnerEmail = *req.OwnerEmail
+	}
+	if req.PlanTier != nil {
+		app.PlanTier = *req.PlanTier
+	}
+	if req.AuthMode != nil {
+		app.AuthMode = *req.AuthMode
+	}
+	if req.RateLimitPerMinute != nil {
+		app.RateLimitPerMinute = *req.RateLimitPerMinute
+	}
+	if req.Scopes != nil {
+		if err := validateScopes(*req.Scopes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		app.Scopes = *req.Scopes
+	}
+
+	if err := h.db.UpdateApplication(c.Request.Context(), app); err != nil {
+		h.respondError(c, err, "Failed to update application")
+		return
+	}
+
+	c.JSON(http.StatusOK, app)
+}
+
+// DisableApplication disables an application without deleting it
+func (h *ApplicationsHandler) DisableApplication(c *gin.Context) {
+	h.setEnabled(c, false)
+}
+
+// EnableApplication re-enables a disabled application
+func (h *ApplicationsHandler) EnableApplication(c *gin.Context) {
+	h.setEnabled(c, true)
+}
+
+// DeleteApplication deletes an application and all of its secrets
+func (h *ApplicationsHandler) DeleteApplication(c *gin.Context) {
+	id := c.Param("id")
+	if !uuidPattern.MatchString(id) {
+		h.respondError(c, sql.ErrNoRows, "")
+		return
+	}
+
+	if err := h.db.DeleteApplication(c.Request.Context(), id); err != nil {
+		h.respondError(c, err, "Failed to delete application")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// setEnabled enables or disables the application named in the path
+func (h *ApplicationsHandler) setEnabled(c *gin.Context, enabled bool) {
+	app, ok := h.loadApplication(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.SetApplicationEnabled(c.Request.Context(), app.ID, enabled); err != nil {
+		h.respondError(c, err, "Failed to update application")
+		return
+	}
+
+	app.Enabled = enabled
+	c.JSON(http.StatusOK, app)
+}
+
+// loadApplication loads the application named in the path, writing an
+// error response and returning false if it cannot be loaded
+func (h *ApplicationsHandler) loadApplication(c *gin.Context) (*models.Application, bool) {
+	id := c.Param("id")
+	if !uuidPattern.MatchString(id) {
+		h.respondError(c, sql.ErrNoRows, "")
+		return nil, false
+	}
+
+	app, err := h.db.GetApplicationByID(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, err, "Failed to load application")
+		return nil, false
+	}
+
+	return app, true
+}
+
+// respondError writes a 404 for missing applications and a 500 with the given message otherwise
+func (h *ApplicationsHandler) respondError(c *gin.Context, err error, message string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Application not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": message,
+	})
+}
+
+// validateScopes checks that every scope is a known scope
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		known := false
+		for _, k := range models.KnownScopes {
+			if scope == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("Unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// queryInt parses an integer query parameter, returning def if it is absent
+func queryInt(c *gin.Context, name string, def int) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/models"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestApplicationsRouter creates a router serving the application
+// management endpoints from an in-memory database
+func newTestApplicationsRouter() (*gin.Engine, *db.MemoryDB) {
+	database := db.NewMemoryDB()
+	h := NewApplicationsHandler(database)
+
+	router := gin.New()
+	router.POST("/applications", h.CreateApplication)
+	router.GET("/applications", h.ListApplications)
+	router.GET("/applications/:id", h.GetApplication)
+	router.PATCH("/applications/:id", h.UpdateApplication)
+	router.POST("/applications/:id/disable", h.DisableApplication)
+	router.POST("/applications/:id/enable", h.EnableApplication)
+	router.DELETE("/applications/:id", h.DeleteApplication)
+	return router, database
+}
+
+// serveJSON serves a request with a JSON body and decodes the JSON response into out, if any
+func serveJSON(t *testing.T, router *gin.Engine, method, target, body string, out interface{}) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if out != nil && w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: failed to decode response %q: %v", method, target, w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+func TestApplicationsCRUD(t *testing.T) {
+	router, database := newTestApplicationsRouter()
+	ctx := context.Background()
+
+	// Create
+	var created models.Application
+	status := serveJSON(t, router, http.MethodPost, "/applications", `{"client_id":"acme","owner_email":"ops@acme.test","scopes":["sunset_quality"]}`, &created)
+	if status != http.StatusCreated {
+		t.Fatalf("create: got status %d, want %d", status, http.StatusCreated)
+	}
+	if created.ClientSecret == "" || !created.Enabled || created.PlanTier != models.PlanTierFree || created.AuthMode != models.AuthModeSecret {
+		t.Errorf("create: got %+v, want an enabled free application authenticating with a generated secret", created)
+	}
+
+	secrets, err := database.GetActiveApplicationSecrets(ctx, created.ID)
+	if err != nil || len(secrets) != 1 || secrets[0].Secret != created.ClientSecret {
+		t.Errorf("create: got secrets %+v (%v), want the returned secret", secrets, err)
+	}
+
+	if status := serveJSON(t, router, http.MethodPost, "/applications", `{"client_id":"acme"}`, nil); status != http.StatusConflict {
+		t.Errorf("create duplicate: got status %d, want %d", status, http.StatusConflict)
+	}
+
+	// Read
+	var fetched models.Application
+	if status := serveJSON(t, router, http.MethodGet, "/applications/"+created.ID, "", &fetched); status != http.StatusOK {
+		t.Fatalf("get: got status %d, want %d", status, http.StatusOK)
+	}
+	if fetched.ClientID != "acme" || fetched.ClientSecret != "" {
+		t.Errorf("get: got client ID %q and secret %q, want acme without its secret", fetched.ClientID, fetched.ClientSecret)
+	}
+
+	var list struct {
+		Applications []models.Application `json:"applications"`
+		Total        int                  `json:"total"`
+	}
+	if status := serveJSON(t, router, http.MethodGet, "/applications?limit=10", "", &list); status != http.StatusOK {
+		t.Fatalf("list: got status %d, want %d", status, http.StatusOK)
+	}
+	if list.Total != 1 || len(list.Applications) != 1 || list.Applications[0].ID != created.ID {
+		t.Errorf("list: got %+v, want the created application", list)
+	}
+
+	// Update
+	var updated models.Application
+	status = serveJSON(t, router, http.MethodPatch, "/applications/"+created.ID, `{"plan_tier":"pro","auth_mode":"hmac","rate_limit_per_minute":120}`, &updated)
+	if status != http.StatusOK {
+		t.Fatalf("update: got status %d, want %d", status, http.StatusOK)
+	}
+	if updated.PlanTier != models.PlanTierPro || updated.AuthMode != models.AuthModeHMAC || updated.RateLimitPerMinute != 120 || updated.OwnerEmail != "ops@acme.test" {
+		t.Errorf("update: got %+v, want a pro HMAC application limited to 120 requests per minute with its owner unchanged", updated)
+	}
+
+	// Disable and enable
+	var toggled models.Application
+	if status := serveJSON(t, router, http.MethodPost, "/applications/"+created.ID+"/disable", "", &toggled); status != http.StatusOK || toggled.Enabled {
+		t.Errorf("disable: got status %d and enabled %t, want %d and false", status, toggled.Enabled, http.StatusOK)
+	}
+	if status := serveJSON(t, router, http.MethodPost, "/applications/"+created.ID+"/enable", "", &toggled); status != http.StatusOK || !toggled.Enabled {
+		t.Errorf("enable: got status %d and enabled %t, want %d and true", status, toggled.Enabled, http.StatusOK)
+	}
+
+	// Delete
+	if status := serveJSON(t, router, http.MethodDelete, "/applications/"+created.ID, "", nil); status != http.StatusNoContent {
+		t.Errorf("delete: got status %d, want %d", status, http.StatusNoContent)
+	}
+	if status := serveJSON(t, router, http.MethodGet, "/applications/"+created.ID, "", nil); status != http.StatusNotFound {
+		t.Errorf("get after delete: got status %d, want %d", status, http.StatusNotFound)
+	}
+	if status := serveJSON(t, router, http.MethodDelete, "/applications/"+created.ID, "", nil); status != http.StatusNotFound {
+		t.Errorf("delete twice: got status %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestApplicationsInvalidRequests(t *testing.T) {
+	router, _ := newTestApplicationsRouter()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"create without client ID", http.MethodPost, "/applications", `{}`, http.StatusBadRequest},
+		{"create with unknown plan", http.MethodPost, "/applications", `{"client_id":"acme","plan_tier":"gold"}`, http.StatusBadRequest},
+		{"create with unknown scope", http.MethodPost, "/applications", `{"client_id":"acme","scopes":["admin"]}`, http.StatusBadRequest},
+		{"list with limit too large", http.MethodGet, "/applications?limit=1000", "", http.StatusBadRequest},
+		{"get with invalid ID", http.MethodGet, "/applications/not-a-uuid", "", http.StatusNotFound},
+		{"update unknown application", http.MethodPatch, "/applications/00000000-0000-0000-0000-000000000001", `{"plan_tier":"pro"}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := serveJSON(t, router, tt.method, tt.target, tt.body, nil); status != tt.status {
+				t.Errorf("got status %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinmahoney/etrenank/internal/services/sunset"
+)
+
+// CacheHandler handles cache inspection endpoints
+type CacheHandler struct {
+	sunsetService *sunset.Service
+}
+
+// NewCacheHandler creates a new cache handler
+func NewCacheHandler(sunsetService *sunset.Service) *CacheHandler {
+	return &CacheHandler{
+		sunsetService: sunsetService,
+	}
+}
+
+// GetStats returns the hit rates of each tier of the sunset quality cache
+// on this instance
+func (h *CacheHandler) GetStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.sunsetService.CacheStats())
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/models"
+	"github.com/kevinmahoney/etrenank/internal/services/features"
+)
+
+// FeatureFlagsHandler handles feature flag management endpoints
+type FeatureFlagsHandler struct {
+	db       db.FeatureFlagRepository
+	features *features.Service
+}
+
+// NewFeatureFlagsHandler creates a new feature flags handler. Changes are
+// made in the database and then invalidated in the feature flag cache.
+func NewFeatureFlagsHandler(db db.FeatureFlagRepository, featureService *features.Service) *FeatureFlagsHandler {
+	return &FeatureFlagsHandler{
+		db:       db,
+		features: featureService,
+	}
+}
+
+// putFeatureFlagRequest is the body of a put feature flag request. An
+// omitted rollout percentage rolls the flag out to every application.
+type putFeatureFlagRequest struct {
+	Description       string `json:"description"`
+	Enabled           *bool  `json:"enabled" binding:"required"`
+	RolloutPercentage *int   `json:"rollout_percentage" binding:"omitempty,min=0,max=100"`
+}
+
+// putOverrideRequest is the body of a put feature flag override request
+type putOverrideRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// ListFeatureFlags lists every feature flag along with its overrides
+func (h *FeatureFlagsHandler) ListFeatureFlags(c *gin.Context) {
+	flags, err := h.db.ListFeatureFlags(c.Request.Context())
+	if err != nil {
+		h.respondError(c, err, "Feature flag not found", "Failed to list feature flags")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"feature_flags": flags,
+	})
+}
+
+// GetFeatureFlag returns a feature flag along with its overrides
+func (h *FeatureFlagsHandler) GetFeatureFlag(c *gin.Context) {
+	flag, err := h.db.GetFeatureFlag(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		h.respondError(c, err, "Feature flag not found", "Failed to load feature flag")
+		return
+	}
+
+	c.JSON(http.StatusOK, flag)
+}
+
+// PutFeatureFlag creates a feature flag or updates it, keeping its overrides
+func (h *FeatureFlagsHandler) PutFeatureFlag(c *gin.Context) {
+	name := c.Param("name")
+	if !models.ValidFeatureName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid feature flag name %q: must be lowercase letters, digits, '_', '.' or '-'", name),
+		})
+		return
+	}
+
+	var req putFeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	flag := &models.FeatureFlag{
+		Name:              name,
+		Description:       req.Description,
+		Enabled:           *req.Enabled,
+		RolloutPercentage: 100,
+	}
+	if req.RolloutPercentage != nil {
+		flag.RolloutPercentage = *req.RolloutPercentage
+	}
+
+	ctx := c.Request.Context()
+	if err := h.db.PutFeatureFlag(ctx, flag); err != nil {
+		h.respondError(c, err, "Feature flag not found", "Failed to save feature flag")
+		return
+	}
+	h.features.Invalidate(ctx)
+
+	flag, err := h.db.GetFeatureFlag(ctx, name)
+	if err != nil {
+		h.respondError(c, err, "Feature flag not found", "Failed to load feature flag")
+		return
+	}
+
+	c.JSON(http.StatusOK, flag)
+}
+
+// DeleteFeatureFlag deletes a feature flag along with its overrides
+func (h *FeatureFlagsHandler) DeleteFeatureFlag(c *gin.Context) {
+	ctx := c.Request.Context()
+	if err := h.db.DeleteFeatureFlag(ctx, c.Param("name")); err != nil {
+		h.respondError(c, err, "Feature flag not found", "Failed to delete feature flag")
+		return
+	}
+	h.features.Invalidate(ctx)
+
+	c.Status(http.StatusNoContent)
+}
+
+// PutOverride turns a feature flag on or off for an application, regardless
+// of its rollout
+func (h *FeatureFlagsHandler) PutOverride(c *gin.Context) {
+	applicationID := c.Param("id")
+	if !uuidPattern.MatchString(applicationID) {
+		h.respondError(c, sql.ErrNoRows, "Feature flag or application not found", "")
+		return
+	}
+
+	var req putOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.db.SetFeatureFlagOverride(ctx, c.Param("name"), applicationID, *req.Enabled); err != nil {
+		h.respondError(c, err, "Feature flag or application not found", "Failed to save feature flag override")
+		return
+	}
+	h.features.Invalidate(ctx)
+
+	c.JSON(http.StatusOK, gin.H{
+		"application_id": applicationID,
+		"enabled":        *req.Enabled,
+	})
+}
+
+// DeleteOverride removes the override of a feature flag for an application,
+// which then follows the rollout again
+func (h *FeatureFlagsHandler) DeleteOverride(c *gin.Context) {
+	applicationID := c.Param("id")
+	if !uuidPattern.MatchString(applicationID) {
+		h.respondError(c, sql.ErrNoRows, "Feature flag override not found", "")
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.db.DeleteFeatureFlagOverride(ctx, c.Param("name"), applicationID); err != nil {
+		h.respondError(c, err, "Feature flag override not found", "Failed to delete feature flag override")
+		return
+	}
+	h.features.Invalidate(ctx)
+
+	c.Status(http.StatusNoContent)
+}
+
+// respondError writes the response for a failed feature flag operation.
+// Missing flags and applications are reported as notFound.
+func (h *FeatureFlagsHandler) respondError(c *gin.Context, err error, notFound, message string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": notFound,
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": message,
+	})
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Authenticate authenticates admin requests using the admin API key
+func Authenticate(apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-Admin-Key")
+
+		if key == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Missing admin credentials",
+			})
+			c.Abort()
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid admin credentials",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,56 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kevinmahoney/etrenank/internal/api/admin/v1/handlers"
+	"github.com/kevinmahoney/etrenank/internal/api/admin/v1/middleware"
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/services/features"
+	"github.com/kevinmahoney/etrenank/internal/services/sunset"
+)
+
+// API represents the v1 admin API
+type API struct {
+	config        *config.Config
+	db            db.Repository
+	sunsetService *sunset.Service
+	features      *features.Service
+}
+
+// NewAPI creates a new v1 admin API
+func NewAPI(cfg *config.Config, db db.Repository, sunsetService *sunset.Service, featureService *features.Service) *API {
+	return &API{
+		config:        cfg,
+		db:            db,
+		sunsetService: sunsetService,
+		features:      featureService,
+	}
+}
+
+// RegisterRoutes registers the v1 admin API routes
+func (a *API) RegisterRoutes(router *gin.RouterGroup) {
+	// Create handlers
+	applicationsHandler := handlers.NewApplicationsHandler(a.db)
+	cacheHandler := handlers.NewCacheHandler(a.sunsetService)
+	featureFlagsHandler := handlers.NewFeatureFlagsHandler(a.db, a.features)
+
+	// All admin routes require the admin credential
+	router.Use(middleware.Authenticate(a.config.Admin.APIKey))
+	{
+		router.POST("/applications", applicationsHandler.CreateApplication)
+		router.GET("/applications", applicationsHandler.ListApplications)
+		router.GET("/applications/:id", applicationsHandler.GetApplication)
+		router.PATCH("/applications/:id", applicationsHandler.UpdateApplication)
+		router.POST("/applications/:id/disable", applicationsHandler.DisableApplication)
+		router.POST("/applications/:id/enable", applicationsHandler.EnableApplication)
+		router.DELETE("/applications/:id", applicationsHandler.DeleteApplication)
+		router.GET("/cache/stats", cacheHandler.GetStats)
+		router.GET("/feature_flags", featureFlagsHandler.ListFeatureFlags)
+		router.GET("/feature_flags/:name", featureFlagsHandler.GetFeatureFlag)
+		router.PUT("/feature_flags/:name", featureFlagsHandler.PutFeatureFlag)
+		router.DELETE("/feature_flags/:name", featureFlagsHandler.DeleteFeatureFlag)
+		router.PUT("/feature_flags/:name/applications/:id", featureFlagsHandler.PutOverride)
+		router.DELETE("/feature_flags/:name/applications/:id", featureFlagsHandler.DeleteOverride)
+	}
+}
@@ -2,40 +2,121 @@ package api
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	adminv1 "github.com/kevinmahoney/etrenank/internal/api/admin/v1"
+	"github.com/kevinmahoney/etrenank/internal/api/middleware"
 	"github.com/kevinmahoney/etrenank/internal/api/v1"
 	"github.com/kevinmahoney/etrenank/internal/config"
 	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/health"
+	"github.com/kevinmahoney/etrenank/internal/lifecycle"
+	"github.com/kevinmahoney/etrenank/internal/metrics"
 	"github.com/kevinmahoney/etrenank/internal/services/cache"
+	"github.com/kevinmahoney/etrenank/internal/services/features"
+	"github.com/kevinmahoney/etrenank/internal/services/prewarm"
+	"github.com/kevinmahoney/etrenank/internal/services/quota"
+	"github.com/kevinmahoney/etrenank/internal/services/sunset"
+	"github.com/kevinmahoney/etrenank/internal/services/usage"
 	"github.com/kevinmahoney/etrenank/internal/services/weather"
+	"github.com/kevinmahoney/etrenank/internal/settings"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // Server represents the API server
 type Server struct {
 	router      *gin.Engine
 	httpServer  *http.Server
-	db          *db.PostgresDB
-	redisClient *cache.RedisClient
+	metricsServer *http.Server
+	db          db.Repository
+	cacheStore  cache.Store
 	weatherClient *weather.Client
+	sunsetService *sunset.Service
+	features      *features.Service
+	usage         *usage.Recorder
+	scheduler     *prewarm.Scheduler
+	settings      *settings.Manager
+	readiness     *health.Checker
 	config      *config.Config
+
+	// shuttingDown fails the readiness probe once shutdown starts
+	shuttingDown atomic.Bool
 }
 
 // NewServer creates a new API server
-func NewServer(cfg *config.Config, database *db.PostgresDB, redisClient *cache.RedisClient) *Server {
-	router := gin.Default()
+func NewServer(cfg *config.Config, database db.Repository, cacheStore cache.Store, runtimeSettings *settings.Manager) *Server {
+	router := gin.New()
+	router.Use(
+		middleware.RequestID(),
+		otelgin.Middleware(cfg.Tracing.ServiceName),
+		middleware.Logger(),
+		middleware.Recovery(),
+		middleware.Metrics(),
+	)
 	
 	// Create weather client
-	weatherClient := weather.NewClient(cfg.Weather.APIKey)
+	weatherClient := weather.NewClient(cfg.Weather, quota.NewTracker(weather.Provider, cfg.Quota, cacheStore))
+
+	// Create sunset quality service
+	sunsetService := sunset.NewService(cfg.Cache, cacheStore, weatherClient, runtimeSettings)
+
+	// Create feature flag service
+	featureService := features.NewService(database, cacheStore, runtimeSettings)
 	
 	server := &Server{
 		router:      router,
 		db:          database,
-		redisClient: redisClient,
+		cacheStore:  cacheStore,
 		weatherClient: weatherClient,
+		sunsetService: sunsetService,
+		features:      featureService,
+		usage:         usage.NewRecorder(database, cfg.Auth.UsageFlushInterval),
+		settings:      runtimeSettings,
 		config:      cfg,
 	}
+	server.httpServer = &http.Server{
+		Addr:    cfg.Server.Address,
+		Handler: router,
+	}
+
+	// Metrics are served on an internal listener, since they expose traffic,
+	// error rates and upstream budgets
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", metrics.Handler())
+	server.metricsServer = &http.Server{
+		Addr:    cfg.Server.MetricsAddress,
+		Handler: metricsMux,
+	}
+
+	// Check the dependencies needed to serve requests. The weather provider
+	// is not critical: scores are still served from the cache while it is
+	// unavailable, and it is unavailable to every instance alike.
+	server.readiness = health.NewChecker(cfg.Health.CheckTimeout,
+		health.Check{Name: "database", Critical: true, Run: database.Ping},
+		health.Check{Name: "cache", Critical: true, Run: cacheStore.Ping},
+		health.Check{
+			Name:  "weather",
+			Run:   func(context.Context) error { return weatherClient.Available() },
+			State: weatherClient.CircuitState,
+		},
+	)
+
+	// Expose cache and connection pool statistics as metrics
+	metrics.RegisterCacheStats("sunset_quality", sunsetService.CacheStats)
+	if pool, ok := database.(interface{ Stats() sql.DBStats }); ok {
+		metrics.RegisterDBStats(pool.Stats)
+	}
+
+	// Create cache pre-warming scheduler
+	if cfg.Prewarm.Enabled {
+		server.scheduler = prewarm.NewScheduler(cfg.Prewarm, database, cacheStore, sunsetService)
+	}
 	
 	// Setup routes
 	server.setupRoutes()
@@ -52,25 +133,153 @@ func (s *Server) setupRoutes() {
 		})
 	})
 	
+	// Kubernetes probes: liveness only reports that the process can serve
+	// requests, while readiness checks its dependencies
+	s.router.GET("/livez", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": health.StatusOK,
+		})
+	})
+	s.router.GET("/readyz", s.readyz)
+
 	// API v1 routes
-	v1API := v1.NewAPI(s.db, s.redisClient, s.weatherClient)
+	v1API := v1.NewAPI(s.config, s.db, s.cacheStore, s.sunsetService, s.settings, s.features, s.usage)
 	v1Group := s.router.Group("/api/v1")
 	{
 		v1API.RegisterRoutes(v1Group)
 	}
+
+	// Admin API v1 routes, only available when an admin credential is configured
+	if s.config.Admin.APIKey != "" {
+		adminV1API := adminv1.NewAPI(s.config, s.db, s.sunsetService, s.features)
+		adminV1Group := s.router.Group("/admin/v1")
+		{
+			adminV1API.RegisterRoutes(adminV1Group)
+		}
+	}
 }
 
-// Start starts the API server
-func (s *Server) Start() error {
-	s.httpServer = &http.Server{
-		Addr:    s.config.Server.Address,
-		Handler: s.router,
+// readyz reports whether the dependencies of the server are usable, with the
+// outcome of each check
+func (s *Server) readyz(c *gin.Context) {
+	if s.shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "shutting_down",
+		})
+		return
 	}
-	
-	return s.httpServer.ListenAndServe()
+
+	report := s.readiness.Run(c.Request.Context())
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
 }
 
-// Shutdown gracefully shuts down the API server
-func (s *Server) Shutdown(ctx context.Context) error {
+// Components returns the components of the server in the order they must
+// start: the runtime settings watcher, the services, the background workers,
+// the metrics listener and finally the HTTP server, which is therefore the
+// first to stop
+func (s *Server) Components() []lifecycle.Component {
+	shutdown := s.config.Shutdown
+
+	components := []lifecycle.Component{
+		{
+			Name: "runtime_settings",
+			Run: func(ctx context.Context) error {
+				s.settings.Run(ctx)
+				return nil
+			},
+			Timeout: shutdown.WorkerTimeout,
+		},
+		{
+			Name:    "feature_flags",
+			Stop:    func(context.Context) error { return s.features.Close() },
+			Timeout: shutdown.CloseTimeout,
+		},
+		{
+			// Draining waits for the refreshes started by requests and by
+			// the scheduler, and for their upstream calls
+			Name: "sunset_quality",
+			Run: func(ctx context.Context) error {
+				s.sunsetService.Run(ctx)
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				err := s.sunsetService.Drain(ctx)
+				if closeErr := s.sunsetService.Close(ctx); err == nil {
+					err = closeErr
+				}
+				return err
+			},
+			Timeout: shutdown.WorkerTimeout,
+		},
+	}
+
+	// Usage is flushed once more after the HTTP server stops, so that the
+	// counts of the last requests are kept
+	components = append(components, lifecycle.Component{
+		Name: "usage_recorder",
+		Run: func(ctx context.Context) error {
+			s.usage.Run(ctx)
+			return nil
+		},
+		Stop:    func(ctx context.Context) error { return s.usage.Flush(ctx) },
+		Timeout: shutdown.CloseTimeout,
+	})
+
+	if s.scheduler != nil {
+		components = append(components, lifecycle.Component{
+			Name: "prewarm_scheduler",
+			Run: func(ctx context.Context) error {
+				s.scheduler.Run(ctx)
+				return nil
+			},
+			Timeout: shutdown.WorkerTimeout,
+		})
+	}
+
+	return append(components, lifecycle.Component{
+		Name: "metrics_server",
+		Run: func(context.Context) error {
+			if err := s.metricsServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+		Stop:    s.metricsServer.Shutdown,
+		Timeout: shutdown.HTTPTimeout,
+	}, lifecycle.Component{
+		Name:    "http_server",
+		Run:     s.serve,
+		Stop:    s.shutdown,
+		Timeout: shutdown.Delay + shutdown.HTTPTimeout,
+	})
+}
+
+// serve serves requests until the server is shut down
+func (s *Server) serve(context.Context) error {
+	if err := s.httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// shutdown fails the readiness probe for the shutdown delay, so that load
+// balancers stop routing requests to the server, then stops accepting
+// requests and waits for those in flight to complete
+func (s *Server) shutdown(ctx context.Context) error {
+	s.shuttingDown.Store(true)
+
+	if delay := s.config.Shutdown.Delay; delay > 0 {
+		slog.Info("Failing readiness before shutting down the HTTP server", "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
 	return s.httpServer.Shutdown(ctx)
 }
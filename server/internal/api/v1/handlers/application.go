@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinmahoney/etrenank/internal/credentials"
+	"github.com/kevinmahoney/etrenank/internal/db"
+)
+
+// ApplicationHandler handles endpoints for the authenticated application
+type ApplicationHandler struct {
+	db                db.ApplicationRepository
+	secretGracePeriod time.Duration
+}
+
+// NewApplicationHandler creates a new application handler
+func NewApplicationHandler(db db.ApplicationRepository, secretGracePeriod time.Duration) *ApplicationHandler {
+	return &ApplicationHandler{
+		db:                db,
+		secretGracePeriod: secretGracePeriod,
+	}
+}
+
+// RotateSecret generates a new client secret for the authenticated application.
+// Previously issued secrets keep working until the grace period has passed.
+func (h *ApplicationHandler) RotateSecret(c *gin.Context) {
+	applicationID := c.GetString("application_id")
+
+	secret, err := credentials.NewSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate client secret",
+		})
+		return
+	}
+
+	previousExpireAt := time.Now().Add(h.secretGracePeriod)
+	newSecret, err := h.db.RotateApplicationSecret(c.Request.Context(), applicationID, secret, previousExpireAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to rotate client secret",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"client_secret":              newSecret.Secret,
+		"created_at":                 newSecret.CreatedAt.Format(time.RFC3339),
+		"previous_secrets_expire_at": previousExpireAt.Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/models"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// rotateSecret serves a rotate secret request for an application, as if
+// it had been authenticated
+func rotateSecret(t *testing.T, h *ApplicationHandler, applicationID string) (int, map[string]string) {
+	t.Helper()
+
+	router := gin.New()
+	router.POST("/application/secrets", func(c *gin.Context) {
+		c.Set("application_id", applicationID)
+		h.RotateSecret(c)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/application/secrets", nil))
+
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+func TestRotateSecretGracePeriod(t *testing.T) {
+	database := db.NewMemoryDB()
+	ctx := context.Background()
+
+	app := &models.Application{
+		ID:           "00000000-0000-0000-0000-000000000001",
+		ClientID:     "acme",
+		ClientSecret: "original_secret",
+		Enabled:      true,
+	}
+	if err := database.CreateApplication(ctx, app); err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+
+	// The previous secret keeps working for the grace period
+	before := time.Now()
+	status, body := rotateSecret(t, NewApplicationHandler(database, time.Hour), app.ID)
+	if status != http.StatusCreated {
+		t.Fatalf("rotate: got status %d, want %d", status, http.StatusCreated)
+	}
+	rotated := body["client_secret"]
+	if rotated == "" || rotated == app.ClientSecret {
+		t.Fatalf("rotate: got secret %q, want a new secret", rotated)
+	}
+
+	expireAt, err := time.Parse(time.RFC3339, body["previous_secrets_expire_at"])
+	if err != nil {
+		t.Fatalf("rotate: invalid expiry %q: %v", body["previous_secrets_expire_at"], err)
+	}
+	if expireAt.Before(before.Add(time.Hour).Truncate(time.Second)) || expireAt.After(time.Now().Add(time.Hour)) {
+		t.Errorf("rotate: previous secrets expire at %s, want an hour from now", expireAt)
+	}
+
+	secrets, err := database.GetActiveApplicationSecrets(ctx, app.ID)
+	if err != nil {
+		t.Fatalf("failed to get secrets: %v", err)
+	}
+	if !hasSecrets(secrets, app.ClientSecret, rotated) || len(secrets) != 2 {
+		t.Errorf("during the grace period: got %d active secrets, want the original and the rotated one", len(secrets))
+	}
+
+	// Without a grace period only the latest secret is active
+	status, body = rotateSecret(t, NewApplicationHandler(database, 0), app.ID)
+	if status != http.StatusCreated {
+		t.Fatalf("rotate again: got status %d, want %d", status, http.StatusCreated)
+	}
+
+	secrets, err = database.GetActiveApplicationSecrets(ctx, app.ID)
+	if err != nil {
+		t.Fatalf("failed to get secrets: %v", err)
+	}
+	if !hasSecrets(secrets, body["client_secret"]) || len(secrets) != 1 {
+		t.Errorf("without a grace period: got %d active secrets, want only the latest one", len(secrets))
+	}
+}
+
+func TestRotateSecretUnknownApplication(t *testing.T) {
+	status, _ := rotateSecret(t, NewApplicationHandler(db.NewMemoryDB(), time.Hour), "00000000-0000-0000-0000-000000000001")
+	if status != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", status, http.StatusInternalServerError)
+	}
+}
+
+// hasSecrets reports whether every wanted secret is among secrets
+func hasSecrets(secrets []models.ApplicationSecret, wanted ...string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, s := range secrets {
+			if s.Secret == w {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
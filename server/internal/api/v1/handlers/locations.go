@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/services/weather"
+)
+
+// LocationsHandler handles the saved locations of the authenticated application
+type LocationsHandler struct {
+	db db.LocationRepository
+	// maxPerApplication caps the locations an application may save, as
+	// every saved location is refreshed upstream by the prewarm scheduler
+	maxPerApplication int
+}
+
+// NewLocationsHandler creates a new locations handler
+func NewLocationsHandler(db db.LocationRepository, maxPerApplication int) *LocationsHandler {
+	return &LocationsHandler{
+		db:                db,
+		maxPerApplication: maxPerApplication,
+	}
+}
+
+// ListSavedLocations lists the saved locations of the authenticated application
+func (h *LocationsHandler) ListSavedLocations(c *gin.Context) {
+	locations, err := h.db.ListSavedLocations(c.Request.Context(), c.GetString("application_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to list saved locations",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"locations": locations,
+	})
+}
+
+// SaveLocation saves a location so that its score is kept warm ahead of sunrise and sunset
+func (h *LocationsHandler) SaveLocation(c *gin.Context) {
+	zipCode := weather.NormalizeLocation(c.Param("zipcode"))
+	if zipCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Zip code is required",
+		})
+		return
+	}
+
+	if !weather.ValidLocation(zipCode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid zip code or location",
+		})
+		return
+	}
+
+	err := h.db.SaveLocation(c.Request.Context(), c.GetString("application_id"), zipCode, h.maxPerApplication)
+	if errors.Is(err, db.ErrLimitExceeded) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("Cannot save more than %d locations", h.maxPerApplication),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to save location",
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteSavedLocation removes a saved location
+func (h *LocationsHandler) DeleteSavedLocation(c *gin.Context) {
+	zipCode := weather.NormalizeLocation(c.Param("zipcode"))
+
+	err := h.db.DeleteSavedLocation(c.Request.Context(), c.GetString("application_id"), zipCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Location is not saved",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete saved location",
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/models"
+)
+
+// newTestLocationsRouter creates a router serving the saved locations of an
+// application, as if it had been authenticated, from an in-memory database
+func newTestLocationsRouter(t *testing.T, maxPerApplication int) (*gin.Engine, *db.MemoryDB, string) {
+	t.Helper()
+
+	database := db.NewMemoryDB()
+	app := &models.Application{
+		ID:       "00000000-0000-0000-0000-000000000001",
+		ClientID: "acme",
+		Enabled:  true,
+	}
+	if err := database.CreateApplication(context.Background(), app); err != nil {
+		t.Fatalf("failed to create application: %v", err)
+	}
+
+	h := NewLocationsHandler(database, maxPerApplication)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("application_id", app.ID) })
+	router.PUT("/saved_locations/:zipcode", h.SaveLocation)
+	return router, database, app.ID
+}
+
+// saveLocation serves a request saving a location and returns its status
+func saveLocation(router *gin.Engine, location string) int {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/saved_locations/"+location, nil))
+	return w.Code
+}
+
+func TestSaveLocationValidation(t *testing.T) {
+	router, _, _ := newTestLocationsRouter(t, 10)
+
+	tests := []struct {
+		name     string
+		location string
+		status   int
+	}{
+		{"ZIP code", "10001", http.StatusNoContent},
+		{"ZIP+4 code", "10001-1234", http.StatusNoContent},
+		{"place name", "New%20York", http.StatusNoContent},
+		{"coordinates", "-33.87,151.21", http.StatusNoContent},
+		{"too long", strings.Repeat("9", 33), http.StatusBadRequest},
+		{"invalid characters", "10001%3B%20DROP", http.StatusBadRequest},
+		{"blank", "%20", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := saveLocation(router, tt.location); status != tt.status {
+				t.Errorf("got status %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
+
+func TestSaveLocationLimit(t *testing.T) {
+	router, database, applicationID := newTestLocationsRouter(t, 2)
+
+	for _, location := range []string{"10001", "10002"} {
+		if status := saveLocation(router, location); status != http.StatusNoContent {
+			t.Fatalf("save %s: got status %d, want %d", location, status, http.StatusNoContent)
+		}
+	}
+
+	if status := saveLocation(router, "10003"); status != http.StatusConflict {
+		t.Errorf("save past the limit: got status %d, want %d", status, http.StatusConflict)
+	}
+	// Saving a location again does not count against the limit
+	if status := saveLocation(router, "10001-1234"); status != http.StatusNoContent {
+		t.Errorf("save again: got status %d, want %d", status, http.StatusNoContent)
+	}
+
+	locations, err := database.ListSavedLocations(context.Background(), applicationID)
+	if err != nil {
+		t.Fatalf("failed to list saved locations: %v", err)
+	}
+	if len(locations) != 2 {
+		t.Errorf("got %d saved locations, want 2", len(locations))
+	}
+}
@@ -1,91 +1,78 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"time"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/kevinmahoney/etrenank/internal/db"
-	"github.com/kevinmahoney/etrenank/internal/models"
-	"github.com/kevinmahoney/etrenank/internal/photoquality"
-	"github.com/kevinmahoney/etrenank/internal/services/cache"
+	"github.com/kevinmahoney/etrenank/internal/logging"
+	"github.com/kevinmahoney/etrenank/internal/services/quota"
+	"github.com/kevinmahoney/etrenank/internal/services/sunset"
 	"github.com/kevinmahoney/etrenank/internal/services/weather"
 )
 
 // SunsetHandler handles sunset quality endpoints
 type SunsetHandler struct {
-	db            *db.PostgresDB
-	redisClient   *cache.RedisClient
-	weatherClient *weather.Client
+	sunsetService *sunset.Service
 }
 
 // NewSunsetHandler creates a new sunset handler
-func NewSunsetHandler(db *db.PostgresDB, redisClient *cache.RedisClient, weatherClient *weather.Client) *SunsetHandler {
+func NewSunsetHandler(sunsetService *sunset.Service) *SunsetHandler {
 	return &SunsetHandler{
-		db:            db,
-		redisClient:   redisClient,
-		weatherClient: weatherClient,
+		sunsetService: sunsetService,
 	}
 }
 
 // GetSunsetQuality handles the sunset quality endpoint
 func (h *SunsetHandler) GetSunsetQuality(c *gin.Context) {
-	zipCode := c.Param("zipcode")
+	zipCode := weather.NormalizeLocation(c.Param("zipcode"))
 	if zipCode == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Zip code is required",
 		})
 		return
 	}
-
-	ctx := c.Request.Context()
-
-	// Try to get from cache first
-	cacheKey := fmt.Sprintf("sunset_quality:%s", zipCode)
-	cachedData, err := h.redisClient.Get(ctx, cacheKey)
-	if err == nil {
-		// Cache hit
-		var sunsetQuality models.SunsetQuality
-		if err := json.Unmarshal([]byte(cachedData), &sunsetQuality); err == nil {
-			c.JSON(http.StatusOK, sunsetQuality)
-			return
-		}
+	if !weather.ValidLocation(zipCode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid zip code or location",
+		})
+		return
 	}
 
-	// Cache miss, fetch from weather API
-	weatherData, astronomyData, err := h.weatherClient.GetWeatherByZipCode(zipCode)
+	result, err := h.sunsetService.GetSunsetQuality(c.Request.Context(), zipCode)
 	if err != nil {
+		// The cause is logged with the request ID rather than returned to clients
+		c.Error(err)
+		if errors.Is(err, weather.ErrCircuitOpen) || errors.Is(err, quota.ErrBudgetExhausted) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Weather provider is temporarily unavailable",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to fetch weather data: %v", err),
+			"error": "Failed to fetch weather data",
 		})
 		return
 	}
+	logging.Set(c.Request.Context(), logging.FieldCache, string(result.Status))
 
-	// Calculate sunset quality
-	overallQuality, factors, interpretation := photoquality.CalculateSunriseQuality(*weatherData, *astronomyData)
-
-	// Create response
-	now := time.Now()
-	expiresAt := now.Add(1 * time.Hour)
+	c.Header("Cache-Status", cacheStatus(result))
+	c.Header("Age", strconv.Itoa(int(result.Age.Seconds())))
+	c.JSON(http.StatusOK, result.Quality)
+}
 
-	sunsetQuality := models.SunsetQuality{
-		ZipCode:        zipCode,
-		OverallQuality: overallQuality,
-		Factors:        factors,
-		Interpretation: interpretation,
-		WeatherData:    *weatherData,
-		AstronomyData:  *astronomyData,
-		LastUpdated:    now.Format(time.RFC3339),
-		ExpiresAt:      expiresAt.Format(time.RFC3339),
-	}
+// cacheStatus formats a Cache-Status header value as described in RFC 9211
+func cacheStatus(result *sunset.Result) string {
+	ttl := int(result.TTL.Seconds())
 
-	// Cache the result with 1 hour TTL
-	jsonData, err := json.Marshal(sunsetQuality)
-	if err == nil {
-		h.redisClient.Set(ctx, cacheKey, string(jsonData), 1*time.Hour)
+	switch result.Status {
+	case sunset.CacheHit:
+		return fmt.Sprintf("etrenank; hit; ttl=%d", ttl)
+	case sunset.CacheStale:
+		return fmt.Sprintf("etrenank; hit; ttl=%d; detail=stale-while-revalidate", ttl)
+	default:
+		return fmt.Sprintf("etrenank; fwd=miss; stored; ttl=%d", ttl)
 	}
-
-	c.JSON(http.StatusOK, sunsetQuality)
 }
@@ -1,59 +1,257 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinmahoney/etrenank/internal/credentials"
 	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/logging"
+	"github.com/kevinmahoney/etrenank/internal/models"
+	"github.com/kevinmahoney/etrenank/internal/services/cache"
+	"github.com/kevinmahoney/etrenank/internal/services/features"
+	"github.com/kevinmahoney/etrenank/internal/services/usage"
+	"github.com/kevinmahoney/etrenank/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
+// Error codes returned alongside authentication and authorization errors so
+// that clients can tell failures apart without parsing messages
+const (
+	ErrCodeMissingCredentials  = "missing_credentials"
+	ErrCodeInvalidClientID     = "invalid_client_id"
+	ErrCodeInvalidClientSecret = "invalid_client_secret"
+	ErrCodeApplicationDisabled = "application_disabled"
+	ErrCodeApplicationExpired  = "application_expired"
+	ErrCodeMissingSignature    = "missing_signature"
+	ErrCodeInvalidTimestamp    = "invalid_timestamp"
+	ErrCodeInvalidSignature    = "invalid_signature"
+	ErrCodeReplayedNonce       = "replayed_nonce"
+	ErrCodeInsufficientScope   = "insufficient_scope"
+	ErrCodeRateLimitExceeded   = "rate_limit_exceeded"
+	ErrCodeFeatureNotEnabled   = "feature_not_enabled"
+	ErrCodeInvalidRequest      = "invalid_request"
+	ErrCodeRequestTooLarge     = "request_too_large"
+	ErrCodeInternal            = "internal_error"
+)
+
+// maxSignedBodySize bounds the body of signed requests, which is read in full
+// to be hashed before the signature is checked
+const maxSignedBodySize = 1 << 20
+
 // AuthMiddleware handles authentication
 type AuthMiddleware struct {
-	db *db.PostgresDB
+	db              db.ApplicationRepository
+	store           cache.Store
+	features        *features.Service
+	usage           *usage.Recorder
+	signatureWindow time.Duration
 }
 
-// NewAuthMiddleware creates a new auth middleware
-func NewAuthMiddleware(db *db.PostgresDB) *AuthMiddleware {
+// NewAuthMiddleware creates a new auth middleware. Signed requests are
+// accepted if their timestamp is within signatureWindow of the server time.
+func NewAuthMiddleware(db db.ApplicationRepository, store cache.Store, featureService *features.Service, usageRecorder *usage.Recorder, signatureWindow time.Duration) *AuthMiddleware {
 	return &AuthMiddleware{
-		db: db,
+		db:              db,
+		store:           store,
+		features:        featureService,
+		usage:           usageRecorder,
+		signatureWindow: signatureWindow,
 	}
 }
 
-// Authenticate authenticates requests using client ID and secret
+// Authenticate authenticates requests using the client ID and either the
+// client secret or an HMAC request signature, depending on the application's
+// auth mode
 func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		clientID := c.GetHeader("X-Client-ID")
-		clientSecret := c.GetHeader("X-Client-Secret")
-
-		if clientID == "" || clientSecret == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Missing authentication credentials",
-			})
-			c.Abort()
+		ctx, span := tracing.Start(c.Request.Context(), "auth.authenticate")
+		app := m.authenticate(ctx, c)
+		if app == nil {
+			span.SetStatus(codes.Error, "authentication failed")
+			span.End()
 			return
 		}
+		span.SetAttributes(attribute.String("app.id", app.ID), attribute.String("app.auth_mode", app.AuthMode))
+		span.End()
+		logging.Set(c.Request.Context(), logging.FieldApplicationID, app.ID)
 
-		// Get application from database
-		app, err := m.db.GetApplicationByClientID(clientID)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid client ID",
-			})
-			c.Abort()
-			return
+		// Set application in context
+		c.Set("application_id", app.ID)
+		c.Set("application", app)
+		c.Set("features", m.features.ForApplication(app.ID))
+		c.Next()
+	}
+}
+
+// authenticate validates the credentials of a request and records its usage.
+// It returns nil after aborting the request if the credentials are invalid.
+func (m *AuthMiddleware) authenticate(ctx context.Context, c *gin.Context) *models.Application {
+	clientID := c.GetHeader("X-Client-ID")
+
+	if clientID == "" {
+		abortWithError(c, http.StatusUnauthorized, ErrCodeMissingCredentials, "Missing authentication credentials")
+		return nil
+	}
+
+	// Get application from database
+	app, err := m.db.GetApplicationByClientID(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		abortWithError(c, http.StatusUnauthorized, ErrCodeInvalidClientID, "Invalid client ID")
+		return nil
+	}
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to validate credentials")
+		return nil
+	}
+
+	if !app.Enabled {
+		abortWithError(c, http.StatusForbidden, ErrCodeApplicationDisabled, "Application is disabled")
+		return nil
+	}
+
+	if app.IsExpired(time.Now()) {
+		abortWithError(c, http.StatusForbidden, ErrCodeApplicationExpired, "Application has expired")
+		return nil
+	}
+
+	// Validate credentials against every active secret of the application
+	secrets, err := m.db.GetActiveApplicationSecrets(ctx, app.ID)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to validate credentials")
+		return nil
+	}
+
+	if app.AuthMode == models.AuthModeHMAC {
+		if !m.verifySignature(ctx, c, app, secrets) {
+			return nil
 		}
+	} else if !verifySecret(c, secrets) {
+		return nil
+	}
 
-		// Validate client secret
-		if app.ClientSecret != clientSecret {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid client secret",
-			})
-			c.Abort()
-			return
+	// Usage is buffered and written in batches, off the request path
+	m.usage.Record(app.ID)
+
+	return app
+}
+
+// verifySecret checks the client secret header, aborting the request if it is invalid
+func verifySecret(c *gin.Context, secrets []models.ApplicationSecret) bool {
+	clientSecret := c.GetHeader("X-Client-Secret")
+
+	if clientSecret == "" {
+		abortWithError(c, http.StatusUnauthorized, ErrCodeMissingCredentials, "Missing authentication credentials")
+		return false
+	}
+
+	matched := false
+	for _, s := range secrets {
+		// Compare every secret in constant time so timing reveals nothing about which one matched
+		if subtle.ConstantTimeCompare([]byte(s.Secret), []byte(clientSecret)) == 1 {
+			matched = true
 		}
+	}
 
-		// Set application ID in context
-		c.Set("application_id", app.ID)
-		c.Next()
+	if !matched {
+		abortWithError(c, http.StatusUnauthorized, ErrCodeInvalidClientSecret, "Invalid client secret")
+		return false
+	}
+
+	return true
+}
+
+// verifySignature checks the HMAC signature headers, aborting the request if
+// the signature is invalid, outside the allowed time window or replayed
+func (m *AuthMiddleware) verifySignature(ctx context.Context, c *gin.Context, app *models.Application, secrets []models.ApplicationSecret) bool {
+	timestamp := c.GetHeader("X-Timestamp")
+	nonce := c.GetHeader("X-Nonce")
+	signature := c.GetHeader("X-Signature")
+
+	if timestamp == "" || nonce == "" || signature == "" {
+		abortWithError(c, http.StatusUnauthorized, ErrCodeMissingSignature, "Missing request signature")
+		return false
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		abortWithError(c, http.StatusUnauthorized, ErrCodeInvalidTimestamp, "Invalid request timestamp")
+		return false
+	}
+
+	skew := time.Since(time.Unix(unix, 0))
+	if skew > m.signatureWindow || skew < -m.signatureWindow {
+		abortWithError(c, http.StatusUnauthorized, ErrCodeInvalidTimestamp, "Request timestamp is outside the allowed window")
+		return false
+	}
+
+	// Read the body for hashing and restore it for the handlers
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSignedBodySize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		abortWithError(c, http.StatusRequestEntityTooLarge, ErrCodeRequestTooLarge, fmt.Sprintf("Request body must not exceed %d bytes", maxSignedBodySize))
+		return false
+	}
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Failed to read request body")
+		return false
 	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	stringToSign := credentials.StringToSign(c.Request.Method, c.Request.URL.Path, c.Request.URL.Query(), timestamp, nonce, body)
+
+	matched := false
+	for _, s := range secrets {
+		expected := credentials.Sign(s.Secret, stringToSign)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1 {
+			matched = true
+		}
+	}
+
+	if !matched {
+		abortWithError(c, http.StatusUnauthorized, ErrCodeInvalidSignature, "Invalid request signature")
+		return false
+	}
+
+	// Only check the nonce once the signature is valid, so that unsigned
+	// requests cannot burn nonces. A nonce must outlive the window on both
+	// sides of the server time to cover every timestamp that is accepted.
+	nonceKey := fmt.Sprintf("hmac_nonce:%s:%s", app.ID, nonce)
+	fresh, err := m.store.SetNX(ctx, nonceKey, timestamp, 2*m.signatureWindow)
+	if errors.Is(err, cache.ErrUnsupported) {
+		// Without a cache store nonces cannot be checked, so signed
+		// requests are rejected rather than left open to replay
+		abortWithError(c, http.StatusServiceUnavailable, ErrCodeInternal, "Signed requests are unavailable without a cache store")
+		return false
+	}
+	if err != nil {
+		abortWithError(c, http.StatusServiceUnavailable, ErrCodeInternal, "Failed to verify request nonce")
+		return false
+	}
+
+	if !fresh {
+		abortWithError(c, http.StatusUnauthorized, ErrCodeReplayedNonce, "Request nonce has already been used")
+		return false
+	}
+
+	return true
+}
+
+// abortWithError aborts the request with an error message and code
+func abortWithError(c *gin.Context, status int, code, message string) {
+	c.JSON(status, gin.H{
+		"error": message,
+		"code":  code,
+	})
+	c.Abort()
 }
@@ -0,0 +1,306 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/credentials"
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/models"
+	"github.com/kevinmahoney/etrenank/internal/services/cache"
+	"github.com/kevinmahoney/etrenank/internal/services/features"
+	"github.com/kevinmahoney/etrenank/internal/services/usage"
+	"github.com/kevinmahoney/etrenank/internal/settings"
+)
+
+const (
+	testSecretClientID = "secret_client"
+	testHMACClientID   = "hmac_client"
+	testClientSecret   = "test_secret"
+	testWindow         = 5 * time.Minute
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testAuth is an authenticated router backed by an in-memory database and cache store
+type testAuth struct {
+	router *gin.Engine
+	db     *db.MemoryDB
+	apps   map[string]*models.Application
+}
+
+// newTestAuth creates a router authenticating requests to every path, with
+// an application for each auth mode and a disabled one
+func newTestAuth(t *testing.T, store cache.Store) *testAuth {
+	t.Helper()
+
+	database := db.NewMemoryDB()
+	runtimeSettings, err := settings.NewManager(config.RuntimeConfig{}, database)
+	if err != nil {
+		t.Fatalf("failed to create runtime settings: %v", err)
+	}
+	featureService := features.NewService(database, store, runtimeSettings)
+	t.Cleanup(func() { featureService.Close() })
+
+	ta := &testAuth{db: database, apps: make(map[string]*models.Application)}
+	for _, app := range []*models.Application{
+		{ClientID: testSecretClientID, AuthMode: models.AuthModeSecret, Enabled: true},
+		{ClientID: testHMACClientID, AuthMode: models.AuthModeHMAC, Enabled: true},
+		{ClientID: "disabled_client", AuthMode: models.AuthModeSecret},
+	} {
+		app.ID, err = credentials.NewUUID()
+		if err != nil {
+			t.Fatalf("failed to generate application ID: %v", err)
+		}
+		app.ClientSecret = testClientSecret
+		app.PlanTier = models.PlanTierFree
+		if err := database.CreateApplication(context.Background(), app); err != nil {
+			t.Fatalf("failed to create application %s: %v", app.ClientID, err)
+		}
+		ta.apps[app.ClientID] = app
+	}
+
+	auth := NewAuthMiddleware(database, store, featureService, usage.NewRecorder(database, time.Minute), testWindow)
+	ta.router = gin.New()
+	ta.router.Use(auth.Authenticate())
+	ta.router.Any("/*path", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"application_id": c.GetString("application_id"),
+		})
+	})
+	return ta
+}
+
+// serve serves a request, returning the response and its error code, if any
+func (ta *testAuth) serve(req *http.Request) (*httptest.ResponseRecorder, string) {
+	w := httptest.NewRecorder()
+	ta.router.ServeHTTP(w, req)
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w, body.Code
+}
+
+// secretRequest creates a request authenticated with a client secret
+func secretRequest(clientID, secret string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/saved_locations", nil)
+	if clientID != "" {
+		req.Header.Set("X-Client-ID", clientID)
+	}
+	if secret != "" {
+		req.Header.Set("X-Client-Secret", secret)
+	}
+	return req
+}
+
+// signedRequest creates a request signed with secret at timestamp
+func signedRequest(method, target, secret string, body []byte, timestamp time.Time, nonce string) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	stringToSign := credentials.StringToSign(method, req.URL.Path, req.URL.Query(), unix, nonce, body)
+
+	req.Header.Set("X-Client-ID", testHMACClientID)
+	req.Header.Set("X-Timestamp", unix)
+	req.Header.Set("X-Nonce", nonce)
+	req.Header.Set("X-Signature", credentials.Sign(secret, stringToSign))
+	return req
+}
+
+func TestAuthenticateSecret(t *testing.T) {
+	ta := newTestAuth(t, cache.NewMemoryStore())
+
+	tests := []struct {
+		name     string
+		clientID string
+		secret   string
+		status   int
+		code     string
+	}{
+		{"valid", testSecretClientID, testClientSecret, http.StatusOK, ""},
+		{"missing client ID", "", testClientSecret, http.StatusUnauthorized, ErrCodeMissingCredentials},
+		{"missing secret", testSecretClientID, "", http.StatusUnauthorized, ErrCodeMissingCredentials},
+		{"unknown client ID", "unknown_client", testClientSecret, http.StatusUnauthorized, ErrCodeInvalidClientID},
+		{"wrong secret", testSecretClientID, "wrong_secret", http.StatusUnauthorized, ErrCodeInvalidClientSecret},
+		{"disabled application", "disabled_client", testClientSecret, http.StatusForbidden, ErrCodeApplicationDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, code := ta.serve(secretRequest(tt.clientID, tt.secret))
+			if w.Code != tt.status || code != tt.code {
+				t.Errorf("got status %d and code %q, want %d and %q", w.Code, code, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestAuthenticateExpiredApplication(t *testing.T) {
+	ta := newTestAuth(t, cache.NewMemoryStore())
+
+	app := ta.apps[testSecretClientID]
+	expiredAt := time.Now().Add(-time.Minute)
+	app.ExpiresAt = &expiredAt
+	if err := ta.db.UpdateApplication(context.Background(), app); err != nil {
+		t.Fatalf("failed to expire application: %v", err)
+	}
+
+	w, code := ta.serve(secretRequest(testSecretClientID, testClientSecret))
+	if w.Code != http.StatusForbidden || code != ErrCodeApplicationExpired {
+		t.Errorf("got status %d and code %q, want %d and %q", w.Code, code, http.StatusForbidden, ErrCodeApplicationExpired)
+	}
+}
+
+func TestAuthenticateSecretRotation(t *testing.T) {
+	ta := newTestAuth(t, cache.NewMemoryStore())
+	ctx := context.Background()
+	appID := ta.apps[testSecretClientID].ID
+
+	// During the grace period both the previous and the new secret work
+	rotated, err := ta.db.RotateApplicationSecret(ctx, appID, "rotated_secret", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to rotate secret: %v", err)
+	}
+	for _, secret := range []string{testClientSecret, rotated.Secret} {
+		if w, code := ta.serve(secretRequest(testSecretClientID, secret)); w.Code != http.StatusOK {
+			t.Errorf("secret %q during the grace period: got status %d and code %q, want %d", secret, w.Code, code, http.StatusOK)
+		}
+	}
+
+	// Once the grace period is over only the latest secret works
+	latest, err := ta.db.RotateApplicationSecret(ctx, appID, "latest_secret", time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("failed to rotate secret: %v", err)
+	}
+	for _, secret := range []string{testClientSecret, rotated.Secret} {
+		if w, code := ta.serve(secretRequest(testSecretClientID, secret)); w.Code != http.StatusUnauthorized || code != ErrCodeInvalidClientSecret {
+			t.Errorf("secret %q after the grace period: got status %d and code %q, want %d and %q", secret, w.Code, code, http.StatusUnauthorized, ErrCodeInvalidClientSecret)
+		}
+	}
+	if w, code := ta.serve(secretRequest(testSecretClientID, latest.Secret)); w.Code != http.StatusOK {
+		t.Errorf("latest secret: got status %d and code %q, want %d", w.Code, code, http.StatusOK)
+	}
+}
+
+func TestAuthenticateHMAC(t *testing.T) {
+	ta := newTestAuth(t, cache.NewMemoryStore())
+	now := time.Now()
+	body := []byte(`{"name":"home"}`)
+
+	tests := []struct {
+		name   string
+		req    func() *http.Request
+		status int
+		code   string
+	}{
+		{
+			name: "valid",
+			req: func() *http.Request {
+				return signedRequest(http.MethodPut, "/api/v1/saved_locations/10001?b=2&a=1", testClientSecret, body, now, "nonce-valid")
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "client secret instead of signature",
+			req: func() *http.Request {
+				return secretRequest(testHMACClientID, testClientSecret)
+			},
+			status: http.StatusUnauthorized,
+			code:   ErrCodeMissingSignature,
+		},
+		{
+			name: "wrong secret",
+			req: func() *http.Request {
+				return signedRequest(http.MethodGet, "/api/v1/saved_locations", "wrong_secret", nil, now, "nonce-wrong-secret")
+			},
+			status: http.StatusUnauthorized,
+			code:   ErrCodeInvalidSignature,
+		},
+		{
+			name: "tampered body",
+			req: func() *http.Request {
+				req := signedRequest(http.MethodPut, "/api/v1/saved_locations/10001", testClientSecret, body, now, "nonce-tampered")
+				req.Body = http.NoBody
+				return req
+			},
+			status: http.StatusUnauthorized,
+			code:   ErrCodeInvalidSignature,
+		},
+		{
+			name: "invalid timestamp",
+			req: func() *http.Request {
+				req := signedRequest(http.MethodGet, "/api/v1/saved_locations", testClientSecret, nil, now, "nonce-invalid-timestamp")
+				req.Header.Set("X-Timestamp", "yesterday")
+				return req
+			},
+			status: http.StatusUnauthorized,
+			code:   ErrCodeInvalidTimestamp,
+		},
+		{
+			name: "timestamp outside the window",
+			req: func() *http.Request {
+				return signedRequest(http.MethodGet, "/api/v1/saved_locations", testClientSecret, nil, now.Add(-2*testWindow), "nonce-old")
+			},
+			status: http.StatusUnauthorized,
+			code:   ErrCodeInvalidTimestamp,
+		},
+		{
+			name: "body too large",
+			req: func() *http.Request {
+				return signedRequest(http.MethodPut, "/api/v1/saved_locations/10001", testClientSecret, []byte(strings.Repeat("x", maxSignedBodySize+1)), now, "nonce-large")
+			},
+			status: http.StatusRequestEntityTooLarge,
+			code:   ErrCodeRequestTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, code := ta.serve(tt.req())
+			if w.Code != tt.status || code != tt.code {
+				t.Errorf("got status %d and code %q, want %d and %q", w.Code, code, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestAuthenticateHMACReplay(t *testing.T) {
+	ta := newTestAuth(t, cache.NewMemoryStore())
+	now := time.Now()
+
+	if w, code := ta.serve(signedRequest(http.MethodGet, "/api/v1/saved_locations", testClientSecret, nil, now, "nonce")); w.Code != http.StatusOK {
+		t.Fatalf("first request: got status %d and code %q, want %d", w.Code, code, http.StatusOK)
+	}
+
+	w, code := ta.serve(signedRequest(http.MethodGet, "/api/v1/saved_locations", testClientSecret, nil, now, "nonce"))
+	if w.Code != http.StatusUnauthorized || code != ErrCodeReplayedNonce {
+		t.Errorf("replayed request: got status %d and code %q, want %d and %q", w.Code, code, http.StatusUnauthorized, ErrCodeReplayedNonce)
+	}
+}
+
+func TestAuthenticateHMACWithoutCacheStore(t *testing.T) {
+	ta := newTestAuth(t, cache.NewNoopStore())
+
+	// Nonces cannot be checked, so signed requests are rejected rather than
+	// left open to replay, while client secrets keep working
+	w, code := ta.serve(signedRequest(http.MethodGet, "/api/v1/saved_locations", testClientSecret, nil, time.Now(), "nonce"))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("signed request: got status %d and code %q, want %d", w.Code, code, http.StatusServiceUnavailable)
+	}
+
+	if w, code := ta.serve(secretRequest(testSecretClientID, testClientSecret)); w.Code != http.StatusOK {
+		t.Errorf("secret request: got status %d and code %q, want %d", w.Code, code, http.StatusOK)
+	}
+}
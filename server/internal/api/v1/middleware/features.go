@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinmahoney/etrenank/internal/services/features"
+)
+
+// Features returns the feature flags of the authenticated application.
+// It must be called after Authenticate.
+func Features(c *gin.Context) *features.Flags {
+	return c.MustGet("features").(*features.Flags)
+}
+
+// FeatureEnabled reports whether a feature is on for the authenticated
+// application. It must be called after Authenticate.
+func FeatureEnabled(c *gin.Context, name string) bool {
+	return Features(c).Enabled(c.Request.Context(), name)
+}
+
+// RequireFeature rejects applications for which a feature is off, so that
+// routes can be rolled out to some applications first. It must run after
+// Authenticate.
+func RequireFeature(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !FeatureEnabled(c, name) {
+			abortWithError(c, http.StatusNotFound, ErrCodeFeatureNotEnabled, "This feature is not enabled for the application")
+			return
+		}
+
+		c.Next()
+	}
+}
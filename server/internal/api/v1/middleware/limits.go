@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinmahoney/etrenank/internal/models"
+	"github.com/kevinmahoney/etrenank/internal/services/cache"
+	"github.com/kevinmahoney/etrenank/internal/settings"
+)
+
+// RequireScope rejects applications that were not granted the given scope.
+// It must run after Authenticate.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app := c.MustGet("application").(*models.Application)
+
+		if !app.HasScope(scope) {
+			abortWithError(c, http.StatusForbidden, ErrCodeInsufficientScope, fmt.Sprintf("Application lacks the %q scope", scope))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RateLimit limits the number of requests per minute of each application
+// to its configured rate limit, unless overridden by the runtime settings,
+// using a fixed one-minute window in the cache store.
+// It must run after Authenticate.
+func RateLimit(store cache.Store, runtimeSettings *settings.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app := c.MustGet("application").(*models.Application)
+		limit := runtimeSettings.Current().RateLimit(app.ClientID, app.RateLimitPerMinute)
+
+		// A zero rate limit means unlimited
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		window := now.Truncate(time.Minute)
+		key := fmt.Sprintf("rate_limit:%s:%d", app.ID, window.Unix())
+
+		count, err := store.Incr(c.Request.Context(), key, time.Minute)
+		if errors.Is(err, cache.ErrUnsupported) {
+			// Without a cache store rate limits are not enforced, which is
+			// reported once when the store is created
+			c.Next()
+			return
+		}
+		if err != nil {
+			// Fail open rather than rejecting traffic when the cache store is unavailable
+			slog.WarnContext(c.Request.Context(), "Failed to check rate limit", "application_id", app.ID, "error", err)
+			c.Next()
+			return
+		}
+
+		remaining := int64(limit) - count
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+		c.Header("X-RateLimit-Remaining", strconv.FormatInt(max(remaining, 0), 10))
+
+		if remaining < 0 {
+			retryAfter := window.Add(time.Minute).Sub(now)
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			abortWithError(c, http.StatusTooManyRequests, ErrCodeRateLimitExceeded, "Rate limit exceeded")
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -4,42 +4,61 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/kevinmahoney/etrenank/internal/api/v1/handlers"
 	"github.com/kevinmahoney/etrenank/internal/api/v1/middleware"
+	"github.com/kevinmahoney/etrenank/internal/config"
 	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/models"
 	"github.com/kevinmahoney/etrenank/internal/services/cache"
-	"github.com/kevinmahoney/etrenank/internal/services/weather"
+	"github.com/kevinmahoney/etrenank/internal/services/features"
+	"github.com/kevinmahoney/etrenank/internal/services/sunset"
+	"github.com/kevinmahoney/etrenank/internal/services/usage"
+	"github.com/kevinmahoney/etrenank/internal/settings"
 )
 
 // API represents the v1 API
 type API struct {
-	db            *db.PostgresDB
-	redisClient   *cache.RedisClient
-	weatherClient *weather.Client
+	config        *config.Config
+	db            db.Repository
+	cacheStore    cache.Store
+	sunsetService *sunset.Service
+	settings      *settings.Manager
+	features      *features.Service
+	usage         *usage.Recorder
 }
 
 // NewAPI creates a new v1 API
-func NewAPI(db *db.PostgresDB, redisClient *cache.RedisClient, weatherClient *weather.Client) *API {
+func NewAPI(cfg *config.Config, db db.Repository, cacheStore cache.Store, sunsetService *sunset.Service, runtimeSettings *settings.Manager, featureService *features.Service, usageRecorder *usage.Recorder) *API {
 	return &API{
+		config:        cfg,
 		db:            db,
-		redisClient:   redisClient,
-		weatherClient: weatherClient,
+		cacheStore:    cacheStore,
+		sunsetService: sunsetService,
+		settings:      runtimeSettings,
+		features:      featureService,
+		usage:         usageRecorder,
 	}
 }
 
 // RegisterRoutes registers the v1 API routes
 func (a *API) RegisterRoutes(router *gin.RouterGroup) {
 	// Create handlers
-	sunsetHandler := handlers.NewSunsetHandler(a.db, a.redisClient, a.weatherClient)
+	sunsetHandler := handlers.NewSunsetHandler(a.sunsetService)
+	applicationHandler := handlers.NewApplicationHandler(a.db, a.config.Auth.SecretGracePeriod)
+	locationsHandler := handlers.NewLocationsHandler(a.db, a.config.Prewarm.SavedLocationsPerApplication)
 
 	// Create middleware
-	authMiddleware := middleware.NewAuthMiddleware(a.db)
+	authMiddleware := middleware.NewAuthMiddleware(a.db, a.cacheStore, a.features, a.usage, a.config.Auth.SignatureWindow)
 
 	// Public routes
 	router.GET("/health", handlers.HealthCheck)
 
 	// Protected routes
 	protected := router.Group("/")
-	protected.Use(authMiddleware.Authenticate())
+	protected.Use(authMiddleware.Authenticate(), middleware.RateLimit(a.cacheStore, a.settings))
 	{
-		protected.GET("/sunset_quality/:zipcode", sunsetHandler.GetSunsetQuality)
+		protected.GET("/sunset_quality/:zipcode", middleware.RequireScope(models.ScopeSunsetQuality), sunsetHandler.GetSunsetQuality)
+		protected.POST("/application/secrets", middleware.RequireScope(models.ScopeRotateSecrets), applicationHandler.RotateSecret)
+		protected.GET("/saved_locations", middleware.RequireScope(models.ScopeSunsetQuality), locationsHandler.ListSavedLocations)
+		protected.PUT("/saved_locations/:zipcode", middleware.RequireScope(models.ScopeSunsetQuality), locationsHandler.SaveLocation)
+		protected.DELETE("/saved_locations/:zipcode", middleware.RequireScope(models.ScopeSunsetQuality), locationsHandler.DeleteSavedLocation)
 	}
 }
@@ -1,9 +1,10 @@
 package config
 
 import (
-	"fmt"
-	"os"
-	"strconv"
+	"net"
+	"net/url"
+	"strings"
+	"time"
 )
 
 // Config holds all configuration for the application
@@ -12,11 +13,27 @@ type Config struct {
 	Database DatabaseConfig
 	Redis    RedisConfig
 	Weather  WeatherConfig
+	Quota    QuotaConfig
+	Auth     AuthConfig
+	Admin    AdminConfig
+	Cache    CacheConfig
+	Prewarm  PrewarmConfig
+	Tracing  TracingConfig
+	Log      LogConfig
+	Health   HealthConfig
+	Shutdown ShutdownConfig
+	Runtime  RuntimeConfig
+
+	// settings holds the effective value of every setting
+	settings []Setting
 }
 
 // ServerConfig holds the server configuration
 type ServerConfig struct {
 	Address string
+	// MetricsAddress is the address of the internal listener serving
+	// Prometheus metrics, kept off the public API
+	MetricsAddress string
 }
 
 // DatabaseConfig holds the database configuration
@@ -26,6 +43,25 @@ type DatabaseConfig struct {
 	User     string
 	Password string
 	DBName   string
+	// SSLMode is the sslmode supported by lib/pq: disable, require, verify-ca or verify-full
+	SSLMode string
+	// SSLRootCert is the path of the CA certificate used by verify-ca and verify-full
+	SSLRootCert string
+	// ConnectTimeout bounds how long opening a connection may take
+	ConnectTimeout time.Duration
+	// AutoMigrate applies pending schema migrations on startup
+	AutoMigrate bool
+
+	// MaxOpenConns caps the number of open connections; zero means unlimited
+	MaxOpenConns int
+	// MaxIdleConns caps the number of idle connections kept in the pool
+	MaxIdleConns int
+	// ConnMaxLifetime is how long a connection may be reused; zero means forever
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime is how long a connection may stay idle; zero means forever
+	ConnMaxIdleTime time.Duration
+	// QueryTimeout bounds how long a single query may take
+	QueryTimeout time.Duration
 }
 
 // RedisConfig holds the Redis configuration
@@ -33,52 +69,488 @@ type RedisConfig struct {
 	Host     string
 	Port     int
 	Password string
+	// OperationTimeout bounds how long a single command may take
+	OperationTimeout time.Duration
 }
 
 // WeatherConfig holds the weather API configuration
 type WeatherConfig struct {
 	APIKey string
+	// BaseURL is the base URL of the weather API
+	BaseURL string
+	// Timeout bounds how long a single request to the weather API may take
+	Timeout time.Duration
+	// MaxRetries is how many times a request failing with a transient error is retried
+	MaxRetries int
+	// RetryBaseDelay is the delay before the first retry, doubled on every retry and jittered
+	RetryBaseDelay time.Duration
+	// RetryMaxDelay caps the delay before a retry, including delays requested by the provider
+	RetryMaxDelay time.Duration
+	// BreakerFailures is how many consecutive failures open the circuit breaker
+	BreakerFailures int
+	// BreakerOpenDuration is how long the circuit breaker refuses requests once open
+	BreakerOpenDuration time.Duration
+}
+
+// QuotaConfig holds the call budget of the weather provider
+type QuotaConfig struct {
+	// DailyBudget caps the calls made per UTC day; zero means unlimited
+	DailyBudget int
+	// MonthlyBudget caps the calls made per UTC month; zero means unlimited
+	MonthlyBudget int
+	// WarnRatio is the share of a budget spent from which a warning is logged
+	WarnRatio float64
+	// CacheOnlyRatio is the share of a budget spent from which the provider
+	// is no longer called and only cached values are served
+	CacheOnlyRatio float64
+}
+
+// AuthConfig holds the client authentication configuration
+type AuthConfig struct {
+	// SecretGracePeriod is how long previous secrets keep working after a rotation
+	SecretGracePeriod time.Duration
+	// SignatureWindow is how far the timestamp of a signed request may be from the server time
+	SignatureWindow time.Duration
+	// UsageFlushInterval is how often the request counts of applications,
+	// buffered in memory, are written to the database
+	UsageFlushInterval time.Duration
+}
+
+// AdminConfig holds the admin API configuration
+type AdminConfig struct {
+	// APIKey authenticates admin requests; the admin API is disabled when empty
+	APIKey string
+}
+
+// CacheConfig holds the cache configuration
+type CacheConfig struct {
+	// Backend selects the cache store: redis, memory or none
+	Backend string
+	// Fallback is the backend used while Redis is unreachable after startup; empty makes Redis required
+	Fallback string
+	// FreshTTL is how long a cached score is served without being refreshed
+	// when the time of the next sunrise or sunset is unknown
+	FreshTTL time.Duration
+	// ObservationUpdateInterval is how often the weather provider updates current conditions
+	ObservationUpdateInterval time.Duration
+	// ForecastUpdateInterval is how often the weather provider updates its forecast
+	ForecastUpdateInterval time.Duration
+	// EventLeadTime is how long before a sunrise or sunset scores follow every observation update
+	EventLeadTime time.Duration
+	// EventGrace is how long after a sunrise or sunset its score remains relevant
+	EventGrace time.Duration
+	// StaleTTL is how long a score is still served after it went stale,
+	// while it is refreshed or the weather provider is unavailable
+	StaleTTL time.Duration
+	// LocalSize is the number of scores held in memory in front of Redis; zero disables the in-memory tier
+	LocalSize int
+	// LocalTTL is the longest a score is held in memory, bounding staleness if an invalidation is missed
+	LocalTTL time.Duration
+}
+
+// PrewarmConfig holds the cache pre-warming scheduler configuration
+type PrewarmConfig struct {
+	Enabled bool
+	// Interval is how often locations are checked
+	Interval time.Duration
+	// LeadTime is how long before a sunrise or sunset a location's score is kept warm
+	LeadTime time.Duration
+	// PopularLocations is how many of the most requested locations are kept warm
+	PopularLocations int
+	// RequestsPerMinute caps the rate of refreshes, and thus of upstream calls
+	RequestsPerMinute int
+	// MaxLocations caps the locations checked per round, bounding how long a round may take
+	MaxLocations int
+	// SavedLocationsPerApplication caps the locations each application may save to be kept warm
+	SavedLocationsPerApplication int
 }
 
-// Load loads the configuration from environment variables
-func Load() (*Config, error) {
-	dbPort, err := strconv.Atoi(getEnv("POSTGRES_PORT", "5432"))
+// TracingConfig holds the OpenTelemetry tracing configuration
+type TracingConfig struct {
+	// Exporter is where spans are sent: none, stdout or otlp
+	Exporter string
+	// ServiceName identifies this service in traces
+	ServiceName string
+	// SampleRatio is the fraction of new traces that are sampled; requests
+	// carrying a sampled parent trace are always sampled
+	SampleRatio float64
+}
+
+// LogConfig holds the logging configuration
+type LogConfig struct {
+	// Level is the minimum level logged: debug, info, warn or error
+	Level string
+	// Format is json or text
+	Format string
+}
+
+// HealthConfig holds the readiness probe configuration
+type HealthConfig struct {
+	// CheckTimeout bounds how long checking a single dependency may take
+	CheckTimeout time.Duration
+}
+
+// ShutdownConfig holds how long each stage of a graceful shutdown may take
+type ShutdownConfig struct {
+	// Delay is how long the readiness probe fails before the server stops
+	// accepting requests, so that load balancers stop routing to it first
+	Delay time.Duration
+	// HTTPTimeout bounds how long in-flight requests may take to complete
+	HTTPTimeout time.Duration
+	// WorkerTimeout bounds how long background workers, and the upstream
+	// calls they are making, may take to complete before they are cancelled
+	WorkerTimeout time.Duration
+	// CloseTimeout bounds closing each connection and flushing traces
+	CloseTimeout time.Duration
+}
+
+// RuntimeConfig holds the sources of the runtime settings, which may
+// change without a restart
+type RuntimeConfig struct {
+	// File is the path of a YAML or TOML runtime settings file, reloaded
+	// when it changes or on SIGHUP; empty disables it
+	File string
+	// Database reads runtime settings from the runtime_settings table too,
+	// overriding those of the file
+	Database bool
+	// PollInterval is how often the runtime_settings table is checked for changes
+	PollInterval time.Duration
+}
+
+// Load loads the configuration of the API server from environment
+// variables, which override the settings of the config file at path, if
+// any. Every invalid or missing setting is reported at once.
+func Load(path string) (*Config, error) {
+	cfg, err := load(path, true)
 	if err != nil {
-		return nil, fmt.Errorf("invalid DB_PORT: %v", err)
+		return nil, err
 	}
+	return cfg, nil
+}
+
+// LoadTools loads the configuration like Load for the command line tools,
+// which do not call the weather provider and so do not require its API key.
+// Unless the config file cannot be read, the configuration is returned even
+// if it is invalid, along with its problems, so that it can be printed.
+func LoadTools(path string) (*Config, error) {
+	return load(path, false)
+}
 
-	redisPort, err := strconv.Atoi(getEnv("REDIS_PORT", "6379"))
+// load loads the configuration, requiring the settings only the API server
+// needs if server is set
+func load(path string, server bool) (*Config, error) {
+	l, err := newLoader(path)
 	if err != nil {
-		return nil, fmt.Errorf("invalid REDIS_PORT: %v", err)
+		return nil, err
 	}
 
+	serverAddress := l.string("SERVER_ADDRESS", ":8080")
+	_, serverPort, err := net.SplitHostPort(serverAddress)
+	l.check(err == nil && serverPort != "", "SERVER_ADDRESS", "must be a host and port such as :8080")
+
+	metricsAddress := l.string("METRICS_ADDRESS", ":9090")
+	_, metricsPort, err := net.SplitHostPort(metricsAddress)
+	l.check(err == nil && metricsPort != "", "METRICS_ADDRESS", "must be a host and port such as :9090")
+	l.check(!addressesConflict(metricsAddress, serverAddress), "METRICS_ADDRESS", "must not listen on the port of SERVER_ADDRESS")
+
+	dbHost := l.string("POSTGRES_HOST", "localhost")
+	dbPort := l.int("POSTGRES_PORT", "5432")
+	l.check(dbPort > 0 && dbPort < 65536, "POSTGRES_PORT", "must be a port number")
+	dbUser := l.string("POSTGRES_USER", "postgres")
+	dbPassword := l.secret("POSTGRES_PASSWORD", "postgres")
+	// As with libpq, the database is named after the user unless set
+	dbName := l.string("POSTGRES_DB", dbUser)
+
+	sslMode := l.string("POSTGRES_SSLMODE", "disable")
+	l.check(isSSLMode(sslMode), "POSTGRES_SSLMODE", "must be disable, require, verify-ca or verify-full")
+	sslRootCert := l.string("POSTGRES_SSLROOTCERT", "")
+
+	dbConnectTimeout := l.duration("POSTGRES_CONNECT_TIMEOUT", "5s")
+	l.check(dbConnectTimeout >= time.Second, "POSTGRES_CONNECT_TIMEOUT", "must be a duration of at least 1s")
+
+	dbMaxOpenConns := l.int("DB_MAX_OPEN_CONNS", "25")
+	l.check(dbMaxOpenConns >= 0, "DB_MAX_OPEN_CONNS", "must be a non-negative integer")
+
+	dbMaxIdleConns := l.int("DB_MAX_IDLE_CONNS", "5")
+	l.check(dbMaxIdleConns >= 0, "DB_MAX_IDLE_CONNS", "must be a non-negative integer")
+
+	dbConnMaxLifetime := l.duration("DB_CONN_MAX_LIFETIME", "30m")
+	dbConnMaxIdleTime := l.duration("DB_CONN_MAX_IDLE_TIME", "5m")
+
+	dbQueryTimeout := l.duration("DB_QUERY_TIMEOUT", "5s")
+	l.check(dbQueryTimeout > 0, "DB_QUERY_TIMEOUT", "must be a positive duration")
+
+	autoMigrate := l.bool("DB_AUTO_MIGRATE", "true")
+
+	redisHost := l.string("REDIS_HOST", "localhost")
+	redisPort := l.int("REDIS_PORT", "6379")
+	l.check(redisPort > 0 && redisPort < 65536, "REDIS_PORT", "must be a port number")
+	redisPassword := l.secret("REDIS_PASSWORD", "")
+
+	redisOperationTimeout := l.duration("REDIS_OPERATION_TIMEOUT", "1s")
+	l.check(redisOperationTimeout > 0, "REDIS_OPERATION_TIMEOUT", "must be a positive duration")
+
+	weatherAPIKey := l.secret("WEATHER_API_KEY", "")
+	l.check(weatherAPIKey != "" || !server, "WEATHER_API_KEY", "must be set")
+
+	weatherBaseURL := l.string("WEATHER_BASE_URL", "https://api.weatherapi.com/v1")
+	baseURL, err := url.Parse(weatherBaseURL)
+	l.check(err == nil && (baseURL.Scheme == "http" || baseURL.Scheme == "https") && baseURL.Host != "", "WEATHER_BASE_URL", "must be an http or https URL")
+
+	weatherTimeout := l.duration("WEATHER_TIMEOUT", "10s")
+	l.check(weatherTimeout > 0, "WEATHER_TIMEOUT", "must be a positive duration")
+
+	weatherMaxRetries := l.int("WEATHER_MAX_RETRIES", "2")
+	l.check(weatherMaxRetries >= 0, "WEATHER_MAX_RETRIES", "must be a non-negative integer")
+
+	weatherRetryBaseDelay := l.duration("WEATHER_RETRY_BASE_DELAY", "200ms")
+	l.check(weatherRetryBaseDelay > 0, "WEATHER_RETRY_BASE_DELAY", "must be a positive duration")
+
+	weatherRetryMaxDelay := l.duration("WEATHER_RETRY_MAX_DELAY", "5s")
+	l.check(weatherRetryMaxDelay >= weatherRetryBaseDelay, "WEATHER_RETRY_MAX_DELAY", "must be a duration of at least WEATHER_RETRY_BASE_DELAY")
+
+	weatherBreakerFailures := l.int("WEATHER_BREAKER_FAILURES", "5")
+	l.check(weatherBreakerFailures > 0, "WEATHER_BREAKER_FAILURES", "must be a positive integer")
+
+	weatherBreakerOpenDuration := l.duration("WEATHER_BREAKER_OPEN_DURATION", "30s")
+	l.check(weatherBreakerOpenDuration > 0, "WEATHER_BREAKER_OPEN_DURATION", "must be a positive duration")
+
+	quotaDailyBudget := l.int("WEATHER_DAILY_BUDGET", "0")
+	l.check(quotaDailyBudget >= 0, "WEATHER_DAILY_BUDGET", "must be a non-negative integer")
+
+	quotaMonthlyBudget := l.int("WEATHER_MONTHLY_BUDGET", "0")
+	l.check(quotaMonthlyBudget >= 0, "WEATHER_MONTHLY_BUDGET", "must be a non-negative integer")
+
+	quotaWarnRatio := l.float("WEATHER_BUDGET_WARN_RATIO", "0.8")
+	l.check(quotaWarnRatio > 0 && quotaWarnRatio <= 1, "WEATHER_BUDGET_WARN_RATIO", "must be greater than 0 and at most 1")
+
+	quotaCacheOnlyRatio := l.float("WEATHER_BUDGET_CACHE_ONLY_RATIO", "0.95")
+	l.check(quotaCacheOnlyRatio > 0 && quotaCacheOnlyRatio <= 1, "WEATHER_BUDGET_CACHE_ONLY_RATIO", "must be greater than 0 and at most 1")
+
+	secretGracePeriod := l.duration("SECRET_GRACE_PERIOD", "168h")
+	l.check(secretGracePeriod >= 0, "SECRET_GRACE_PERIOD", "must be a non-negative duration")
+
+	signatureWindow := l.duration("SIGNATURE_WINDOW", "5m")
+	l.check(signatureWindow > 0, "SIGNATURE_WINDOW", "must be a positive duration")
+
+	usageFlushInterval := l.duration("USAGE_FLUSH_INTERVAL", "10s")
+	l.check(usageFlushInterval > 0, "USAGE_FLUSH_INTERVAL", "must be a positive duration")
+
+	adminAPIKey := l.secret("ADMIN_API_KEY", "")
+
+	cacheBackend := l.string("CACHE_BACKEND", "redis")
+	l.check(isCacheBackend(cacheBackend), "CACHE_BACKEND", "must be redis, memory or none")
+
+	cacheFallback := l.string("CACHE_FALLBACK", "")
+	l.check(cacheFallback == "" || isCacheBackend(cacheFallback), "CACHE_FALLBACK", "must be redis, memory or none")
+
+	cacheFreshTTL := l.duration("CACHE_FRESH_TTL", "1h")
+	l.check(cacheFreshTTL > 0, "CACHE_FRESH_TTL", "must be a positive duration")
+
+	observationUpdateInterval := l.duration("CACHE_OBSERVATION_UPDATE_INTERVAL", "15m")
+	l.check(observationUpdateInterval > 0, "CACHE_OBSERVATION_UPDATE_INTERVAL", "must be a positive duration")
+
+	forecastUpdateInterval := l.duration("CACHE_FORECAST_UPDATE_INTERVAL", "3h")
+	l.check(forecastUpdateInterval > 0, "CACHE_FORECAST_UPDATE_INTERVAL", "must be a positive duration")
+
+	eventLeadTime := l.duration("CACHE_EVENT_LEAD_TIME", "2h")
+	eventGrace := l.duration("CACHE_EVENT_GRACE", "30m")
+
+	cacheStaleTTL := l.duration("CACHE_STALE_TTL", "24h")
+	l.check(cacheStaleTTL >= 0, "CACHE_STALE_TTL", "must be a non-negative duration")
+
+	cacheLocalSize := l.int("CACHE_LOCAL_SIZE", "1000")
+	l.check(cacheLocalSize >= 0, "CACHE_LOCAL_SIZE", "must be a non-negative integer")
+
+	cacheLocalTTL := l.duration("CACHE_LOCAL_TTL", "1m")
+	l.check(cacheLocalSize == 0 || cacheLocalTTL > 0, "CACHE_LOCAL_TTL", "must be a positive duration")
+
+	prewarmEnabled := l.bool("PREWARM_ENABLED", "false")
+
+	prewarmInterval := l.duration("PREWARM_INTERVAL", "5m")
+	l.check(prewarmInterval > 0, "PREWARM_INTERVAL", "must be a positive duration")
+
+	prewarmLeadTime := l.duration("PREWARM_LEAD_TIME", "90m")
+
+	prewarmPopularLocations := l.int("PREWARM_POPULAR_LOCATIONS", "100")
+	l.check(prewarmPopularLocations >= 0, "PREWARM_POPULAR_LOCATIONS", "must be a non-negative integer")
+
+	prewarmRequestsPerMinute := l.int("PREWARM_REQUESTS_PER_MINUTE", "30")
+	l.check(prewarmRequestsPerMinute > 0, "PREWARM_REQUESTS_PER_MINUTE", "must be a positive integer")
+
+	prewarmMaxLocations := l.int("PREWARM_MAX_LOCATIONS", "500")
+	l.check(prewarmMaxLocations > 0, "PREWARM_MAX_LOCATIONS", "must be a positive integer")
+
+	prewarmSavedLocations := l.int("PREWARM_SAVED_LOCATIONS_PER_APPLICATION", "50")
+	l.check(prewarmSavedLocations > 0, "PREWARM_SAVED_LOCATIONS_PER_APPLICATION", "must be a positive integer")
+
+	tracingExporter := l.string("TRACING_EXPORTER", "none")
+	l.check(tracingExporter == "none" || tracingExporter == "stdout" || tracingExporter == "otlp", "TRACING_EXPORTER", "must be none, stdout or otlp")
+
+	tracingServiceName := l.string("OTEL_SERVICE_NAME", "etrenank-api")
+
+	tracingSampleRatio := l.float("TRACING_SAMPLE_RATIO", "1")
+	l.check(tracingSampleRatio >= 0 && tracingSampleRatio <= 1, "TRACING_SAMPLE_RATIO", "must be between 0 and 1")
+
+	logLevel := strings.ToLower(l.string("LOG_LEVEL", "info"))
+	l.check(logLevel == "debug" || logLevel == "info" || logLevel == "warn" || logLevel == "error", "LOG_LEVEL", "must be debug, info, warn or error")
+
+	logFormat := strings.ToLower(l.string("LOG_FORMAT", "json"))
+	l.check(logFormat == "json" || logFormat == "text", "LOG_FORMAT", "must be json or text")
+
+	healthCheckTimeout := l.duration("HEALTH_CHECK_TIMEOUT", "2s")
+	l.check(healthCheckTimeout > 0, "HEALTH_CHECK_TIMEOUT", "must be a positive duration")
+
+	shutdownDelay := l.duration("SHUTDOWN_DELAY", "0s")
+	l.check(shutdownDelay >= 0, "SHUTDOWN_DELAY", "must not be negative")
+
+	shutdownHTTPTimeout := l.duration("SHUTDOWN_HTTP_TIMEOUT", "15s")
+	l.check(shutdownHTTPTimeout > 0, "SHUTDOWN_HTTP_TIMEOUT", "must be a positive duration")
+
+	shutdownWorkerTimeout := l.duration("SHUTDOWN_WORKER_TIMEOUT", "10s")
+	l.check(shutdownWorkerTimeout > 0, "SHUTDOWN_WORKER_TIMEOUT", "must be a positive duration")
+
+	shutdownCloseTimeout := l.duration("SHUTDOWN_CLOSE_TIMEOUT", "5s")
+	l.check(shutdownCloseTimeout > 0, "SHUTDOWN_CLOSE_TIMEOUT", "must be a positive duration")
+
+	settingsFile := l.string("RUNTIME_SETTINGS_FILE", "")
+	settingsDatabase := l.bool("RUNTIME_SETTINGS_DATABASE", "false")
+
+	settingsPollInterval := l.duration("RUNTIME_SETTINGS_POLL_INTERVAL", "30s")
+	l.check(settingsPollInterval > 0, "RUNTIME_SETTINGS_POLL_INTERVAL", "must be a positive duration")
+
 	return &Config{
 		Server: ServerConfig{
-			Address: getEnv("SERVER_ADDRESS", ":8080"),
+			Address:        serverAddress,
+			MetricsAddress: metricsAddress,
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("POSTGRES_HOST", "localhost"),
-			Port:     dbPort,
-			User:     getEnv("POSTGRES_USER", "postgres"),
-			Password: getEnv("POSTGRES_PASSWORD", "postgres"),
-			DBName:   getEnv("POSTGRES_DB", ""),
+			Host:            dbHost,
+			Port:            dbPort,
+			User:            dbUser,
+			Password:        dbPassword,
+			DBName:          dbName,
+			SSLMode:         sslMode,
+			SSLRootCert:     sslRootCert,
+			ConnectTimeout:  dbConnectTimeout,
+			AutoMigrate:     autoMigrate,
+			MaxOpenConns:    dbMaxOpenConns,
+			MaxIdleConns:    dbMaxIdleConns,
+			ConnMaxLifetime: dbConnMaxLifetime,
+			ConnMaxIdleTime: dbConnMaxIdleTime,
+			QueryTimeout:    dbQueryTimeout,
 		},
 		Redis: RedisConfig{
-			Host:     getEnv("REDIS_HOST", "localhost"),
-			Port:     redisPort,
-			Password: getEnv("REDIS_PASSWORD", ""),
+			Host:             redisHost,
+			Port:             redisPort,
+			Password:         redisPassword,
+			OperationTimeout: redisOperationTimeout,
 		},
 		Weather: WeatherConfig{
-			APIKey: getEnv("WEATHER_API_KEY", ""),
+			APIKey:              weatherAPIKey,
+			BaseURL:             strings.TrimSuffix(weatherBaseURL, "/"),
+			Timeout:             weatherTimeout,
+			MaxRetries:          weatherMaxRetries,
+			RetryBaseDelay:      weatherRetryBaseDelay,
+			RetryMaxDelay:       weatherRetryMaxDelay,
+			BreakerFailures:     weatherBreakerFailures,
+			BreakerOpenDuration: weatherBreakerOpenDuration,
+		},
+		Quota: QuotaConfig{
+			DailyBudget:    quotaDailyBudget,
+			MonthlyBudget:  quotaMonthlyBudget,
+			WarnRatio:      quotaWarnRatio,
+			CacheOnlyRatio: quotaCacheOnlyRatio,
+		},
+		Auth: AuthConfig{
+			SecretGracePeriod:  secretGracePeriod,
+			SignatureWindow:    signatureWindow,
+			UsageFlushInterval: usageFlushInterval,
+		},
+		Admin: AdminConfig{
+			APIKey: adminAPIKey,
+		},
+		Cache: CacheConfig{
+			Backend:                   cacheBackend,
+			Fallback:                  cacheFallback,
+			FreshTTL:                  cacheFreshTTL,
+			ObservationUpdateInterval: observationUpdateInterval,
+			ForecastUpdateInterval:    forecastUpdateInterval,
+			EventLeadTime:             eventLeadTime,
+			EventGrace:                eventGrace,
+			StaleTTL:                  cacheStaleTTL,
+			LocalSize:                 cacheLocalSize,
+			LocalTTL:                  cacheLocalTTL,
+		},
+		Prewarm: PrewarmConfig{
+			Enabled:                      prewarmEnabled,
+			Interval:                     prewarmInterval,
+			LeadTime:                     prewarmLeadTime,
+			PopularLocations:             prewarmPopularLocations,
+			RequestsPerMinute:            prewarmRequestsPerMinute,
+			MaxLocations:                 prewarmMaxLocations,
+			SavedLocationsPerApplication: prewarmSavedLocations,
+		},
+		Tracing: TracingConfig{
+			Exporter:    tracingExporter,
+			ServiceName: tracingServiceName,
+			SampleRatio: tracingSampleRatio,
+		},
+		Log: LogConfig{
+			Level:  logLevel,
+			Format: logFormat,
 		},
-	}, nil
+		Health: HealthConfig{
+			CheckTimeout: healthCheckTimeout,
+		},
+		Shutdown: ShutdownConfig{
+			Delay:         shutdownDelay,
+			HTTPTimeout:   shutdownHTTPTimeout,
+			WorkerTimeout: shutdownWorkerTimeout,
+			CloseTimeout:  shutdownCloseTimeout,
+		},
+		Runtime: RuntimeConfig{
+			File:         settingsFile,
+			Database:     settingsDatabase,
+			PollInterval: settingsPollInterval,
+		},
+		settings: l.settings,
+	}, l.err()
+}
+
+// Settings returns the effective value of every setting and where it came from
+func (c *Config) Settings() []Setting {
+	return c.settings
+}
+
+// isCacheBackend reports whether backend names a cache backend
+func isCacheBackend(backend string) bool {
+	return backend == "redis" || backend == "memory" || backend == "none"
+}
+
+// addressesConflict reports whether two listen addresses would bind the same
+// port: their ports are equal and so are their hosts, or either listens on
+// every interface
+func addressesConflict(a, b string) bool {
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+	if errA != nil || errB != nil || portA != portB {
+		return false
+	}
+	return hostA == hostB || isWildcardHost(hostA) || isWildcardHost(hostB)
+}
+
+// isWildcardHost reports whether a listen address host means every interface
+func isWildcardHost(host string) bool {
+	return host == "" || host == "0.0.0.0" || host == "::"
 }
 
-// getEnv gets an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// isSSLMode reports whether mode is an sslmode supported by lib/pq, which
+// rejects allow and prefer when connecting
+func isSSLMode(mode string) bool {
+	switch mode {
+	case "disable", "require", "verify-ca", "verify-full":
+		return true
 	}
-	return value
+	return false
 }
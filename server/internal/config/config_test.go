@@ -0,0 +1,74 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// loadWithEnv loads the configuration of the API server with the given
+// environment variables set
+func loadWithEnv(t *testing.T, env map[string]string) (*Config, error) {
+	t.Helper()
+
+	t.Setenv("WEATHER_API_KEY", "test")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	return Load("")
+}
+
+func TestLoadSSLMode(t *testing.T) {
+	tests := []struct {
+		mode  string
+		valid bool
+	}{
+		{"disable", true},
+		{"require", true},
+		{"verify-ca", true},
+		{"verify-full", true},
+		// lib/pq rejects these when connecting
+		{"allow", false},
+		{"prefer", false},
+		{"bogus", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			_, err := loadWithEnv(t, map[string]string{"POSTGRES_SSLMODE": tt.mode})
+			if tt.valid && err != nil {
+				t.Errorf("got error %v, want none", err)
+			}
+			if !tt.valid && (err == nil || !strings.Contains(err.Error(), "invalid POSTGRES_SSLMODE")) {
+				t.Errorf("got error %v, want an invalid POSTGRES_SSLMODE error", err)
+			}
+		})
+	}
+}
+
+func TestLoadMetricsAddress(t *testing.T) {
+	tests := []struct {
+		server  string
+		metrics string
+		valid   bool
+	}{
+		{":8080", ":9090", true},
+		{"127.0.0.1:8080", "10.0.0.1:8080", true},
+		{":8080", ":8080", false},
+		{":8080", "0.0.0.0:8080", false},
+		{":8080", "localhost:8080", false},
+		{"127.0.0.1:8080", "[::]:8080", false},
+		{"127.0.0.1:8080", "127.0.0.1:8080", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.server+" "+tt.metrics, func(t *testing.T) {
+			_, err := loadWithEnv(t, map[string]string{"SERVER_ADDRESS": tt.server, "METRICS_ADDRESS": tt.metrics})
+			if tt.valid && err != nil {
+				t.Errorf("got error %v, want none", err)
+			}
+			if !tt.valid && (err == nil || !strings.Contains(err.Error(), "invalid METRICS_ADDRESS")) {
+				t.Errorf("got error %v, want an invalid METRICS_ADDRESS error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable holding the path of the config file
+const FileEnv = "CONFIG_FILE"
+
+// Sources of a setting
+const (
+	SourceEnv     = "env"
+	SourceFile    = "file"
+	SourceDefault = "default"
+)
+
+// redacted replaces the value of secret settings when they are printed
+const redacted = "[REDACTED]"
+
+// Setting is the effective value of a configuration setting and where it came from
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+	Secret bool
+}
+
+// Redacted returns the value of the setting, or a placeholder if it is a non-empty secret
+func (s Setting) Redacted() string {
+	if s.Secret && s.Value != "" {
+		return redacted
+	}
+	return s.Value
+}
+
+// loader looks up settings in the environment, then in the config file, then
+// falls back to their default. It collects every invalid setting instead of
+// stopping at the first one.
+type loader struct {
+	path     string
+	file     map[string]string
+	settings []Setting
+	invalid  map[string]bool
+	problems []string
+}
+
+// newLoader creates a loader reading the config file at path, if any. The
+// file may be YAML or TOML. Its keys are the names of the environment
+// variables, in any case, and may be nested by their underscore-separated
+// prefixes, so that postgres.host sets POSTGRES_HOST.
+func newLoader(path string) (*loader, error) {
+	l := &loader{
+		path:    path,
+		file:    make(map[string]string),
+		invalid: make(map[string]bool),
+	}
+	if path == "" {
+		return l, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var values map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s: must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	l.flatten("", values)
+	return l, nil
+}
+
+// flatten adds nested file values to the file settings, joining their keys
+func (l *loader) flatten(prefix string, values map[string]interface{}) {
+	for key, value := range values {
+		key = strings.ToUpper(prefix + key)
+		switch v := value.(type) {
+		case map[string]interface{}:
+			l.flatten(key+"_", v)
+		case []interface{}:
+			l.problem(key, "must be a single value, not a list")
+		case nil:
+			l.file[key] = ""
+		default:
+			l.file[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+// lookup returns the value of a setting and records it. An environment
+// variable that is set overrides the config file even if it is empty, so
+// that a file setting can be cleared, while an empty file value is unset.
+func (l *loader) lookup(key, defaultValue string, secret bool) string {
+	setting := Setting{Key: key, Value: defaultValue, Source: SourceDefault, Secret: secret}
+	if value, ok := os.LookupEnv(key); ok {
+		setting.Value, setting.Source = value, SourceEnv
+	} else if value, ok := l.file[key]; ok && value != "" {
+		setting.Value, setting.Source = value, SourceFile
+	}
+
+	l.settings = append(l.settings, setting)
+	return setting.Value
+}
+
+// string returns a string setting
+func (l *loader) string(key, defaultValue string) string {
+	return l.lookup(key, defaultValue, false)
+}
+
+// secret returns a string setting that must not be printed
+func (l *loader) secret(key, defaultValue string) string {
+	return l.lookup(key, defaultValue, true)
+}
+
+// int returns an integer setting
+func (l *loader) int(key, defaultValue string) int {
+	value, err := strconv.Atoi(l.string(key, defaultValue))
+	if err != nil {
+		l.problem(key, "must be an integer")
+	}
+	return value
+}
+
+// float returns a floating-point setting
+func (l *loader) float(key, defaultValue string) float64 {
+	value, err := strconv.ParseFloat(l.string(key, defaultValue), 64)
+	if err != nil {
+		l.problem(key, "must be a number")
+	}
+	return value
+}
+
+// bool returns a boolean setting
+func (l *loader) bool(key, defaultValue string) bool {
+	value, err := strconv.ParseBool(l.string(key, defaultValue))
+	if err != nil {
+		l.problem(key, "must be true or false")
+	}
+	return value
+}
+
+// duration returns a duration setting
+func (l *loader) duration(key, defaultValue string) time.Duration {
+	value, err := time.ParseDuration(l.string(key, defaultValue))
+	if err != nil {
+		l.problem(key, "must be a duration such as 30s or 5m")
+	}
+	return value
+}
+
+// check records a problem with a setting unless ok. Settings that could not
+// be parsed are not checked again.
+func (l *loader) check(ok bool, key, problem string) {
+	if !ok && !l.invalid[key] {
+		l.problem(key, problem)
+	}
+}
+
+// problem records a problem with a setting
+func (l *loader) problem(key, problem string) {
+	l.invalid[key] = true
+	l.problems = append(l.problems, fmt.Sprintf("invalid %s: %s", key, problem))
+}
+
+// err returns every problem found, including settings of the config file
+// that are never read, which are most likely misspelled
+func (l *loader) err() error {
+	known := make(map[string]bool, len(l.settings))
+	for _, setting := range l.settings {
+		known[setting.Key] = true
+	}
+
+	var unknown []string
+	for key := range l.file {
+		if !known[key] {
+			unknown = append(unknown, fmt.Sprintf("unknown setting %s in %s", key, l.path))
+		}
+	}
+	sort.Strings(unknown)
+
+	problems := append(l.problems, unknown...)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	errs := make([]error, len(problems))
+	for i, problem := range problems {
+		errs[i] = errors.New(problem)
+	}
+	return fmt.Errorf("invalid configuration:\n%v", errors.Join(errs...))
+}
@@ -0,0 +1,34 @@
+package credentials
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// secretBytes is the amount of entropy in a generated client secret
+const secretBytes = 32
+
+// NewSecret generates a new random client secret
+func NewSecret() (string, error) {
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewUUID generates a new random (version 4) UUID
+func NewUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate UUID: %v", err)
+	}
+
+	// Set version (4) and variant (RFC 4122) bits
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,33 @@
+package credentials
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// StringToSign builds the canonical representation of a request that is
+// signed in HMAC auth mode. It joins, with newlines, the upper-cased method,
+// the URL path, the query string with its parameters sorted by name, the
+// timestamp, the nonce and the hex-encoded SHA-256 hash of the body.
+func StringToSign(method, path string, query url.Values, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		query.Encode(),
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+// Sign computes the hex-encoded HMAC-SHA256 signature of stringToSign
+func Sign(secret, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
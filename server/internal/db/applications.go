@@ -0,0 +1,343 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/credentials"
+	"github.com/kevinmahoney/etrenank/internal/models"
+	"github.com/lib/pq"
+)
+
+// applicationColumns lists the columns scanned by scanApplication
+const applicationColumns = `id, client_id, enabled, expires_at, owner_email, plan_tier, auth_mode,
+	rate_limit_per_minute, scopes, last_used_at, created_at, updated_at`
+
+// scanApplication scans a row selected with applicationColumns
+func scanApplication(row scanner) (*models.Application, error) {
+	var app models.Application
+	err := row.Scan(
+		&app.ID, &app.ClientID, &app.Enabled, &app.ExpiresAt, &app.OwnerEmail, &app.PlanTier, &app.AuthMode,
+		&app.RateLimitPerMinute, pq.Array(&app.Scopes), &app.LastUsedAt, &app.CreatedAt, &app.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// GetApplicationByID retrieves an application by its ID
+func (p *PostgresDB) GetApplicationByID(ctx context.Context, id string) (*models.Application, error) {
+	ctx, end := p.operation(ctx, "GetApplicationByID")
+	defer end()
+
+	query := `SELECT ` + applicationColumns + ` FROM applications WHERE id = $1`
+
+	return scanApplication(p.db.QueryRowContext(ctx, query, id))
+}
+
+// GetApplicationByClientID retrieves an application by its client ID
+func (p *PostgresDB) GetApplicationByClientID(ctx context.Context, clientID string) (*models.Application, error) {
+	ctx, end := p.operation(ctx, "GetApplicationByClientID")
+	defer end()
+
+	query := `SELECT ` + applicationColumns + ` FROM applications WHERE client_id = $1`
+
+	return scanApplication(p.db.QueryRowContext(ctx, query, clientID))
+}
+
+// CreateApplication creates a new application along with its initial secret
+func (p *PostgresDB) CreateApplication(ctx context.Context, app *models.Application) error {
+	ctx, end := p.operation(ctx, "CreateApplication")
+	defer end()
+
+	secretID, err := credentials.NewUUID()
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO applications
+		(id, client_id, enabled, expires_at, owner_email, plan_tier, auth_mode, rate_limit_per_minute, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING created_at, updated_at`
+	err = tx.QueryRowContext(
+		ctx, query, app.ID, app.ClientID, app.Enabled, app.ExpiresAt, app.OwnerEmail, app.PlanTier, app.AuthMode,
+		app.RateLimitPerMinute, scopesArray(app.Scopes),
+	).Scan(&app.CreatedAt, &app.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO application_secrets (id, application_id, secret) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, query, secretID, app.ID, app.ClientSecret); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListApplications retrieves a page of applications ordered by client ID.
+// A limit of zero or less returns every application after the offset.
+func (p *PostgresDB) ListApplications(ctx context.Context, limit, offset int) ([]models.Application, error) {
+	ctx, end := p.operation(ctx, "ListApplications")
+	defer end()
+
+	query := `SELECT ` + applicationColumns + ` FROM applications ORDER BY client_id`
+	if limit > 0 {
+		query += fmt.Sprintf(` LIMIT %d`, limit)
+	}
+	query += fmt.Sprintf(` OFFSET %d`, max(offset, 0))
+
+	rows, err := p.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	apps := []models.Application{}
+	for rows.Next() {
+		app, err := scanApplication(rows)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, *app)
+	}
+
+	return apps, rows.Err()
+}
+
+// CountApplications returns the total number of applications
+func (p *PostgresDB) CountApplications(ctx context.Context) (int, error) {
+	ctx, end := p.operation(ctx, "CountApplications")
+	defer end()
+
+	query := `SELECT COUNT(*) FROM applications`
+
+	var count int
+	err := p.db.QueryRowContext(ctx, query).Scan(&count)
+	return count, err
+}
+
+// UpdateApplication updates the expiry, owner, plan, auth mode, rate limit and scopes of an application
+func (p *PostgresDB) UpdateApplication(ctx context.Context, app *models.Application) error {
+	ctx, end := p.operation(ctx, "UpdateApplication")
+	defer end()
+
+	query := `UPDATE applications
+		SET expires_at = $2, owner_email = $3, plan_tier = $4, auth_mode = $5,
+			rate_limit_per_minute = $6, scopes = $7, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at`
+
+	return p.db.QueryRowContext(
+		ctx, query, app.ID, app.ExpiresAt, app.OwnerEmail, app.PlanTier, app.AuthMode,
+		app.RateLimitPerMinute, scopesArray(app.Scopes),
+	).Scan(&app.UpdatedAt)
+}
+
+// SetApplicationEnabled enables or disables an application by its ID
+func (p *PostgresDB) SetApplicationEnabled(ctx context.Context, id string, enabled bool) error {
+	ctx, end := p.operation(ctx, "SetApplicationEnabled")
+	defer end()
+
+	query := `UPDATE applications SET enabled = $2, updated_at = NOW() WHERE id = $1`
+
+	result, err := p.db.ExecContext(ctx, query, id, enabled)
+	if err != nil {
+		return err
+	}
+
+	return expectRowsAffected(result)
+}
+
+// DeleteApplication deletes an application by its ID
+func (p *PostgresDB) DeleteApplication(ctx context.Context, id string) error {
+	ctx, end := p.operation(ctx, "DeleteApplication")
+	defer end()
+
+	query := `DELETE FROM applications WHERE id = $1`
+
+	result, err := p.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return expectRowsAffected(result)
+}
+
+// GetActiveApplicationSecrets retrieves the secrets of an application that have not expired
+func (p *PostgresDB) GetActiveApplicationSecrets(ctx context.Context, applicationID string) ([]models.ApplicationSecret, error) {
+	ctx, end := p.operation(ctx, "GetActiveApplicationSecrets")
+	defer end()
+
+	query := `SELECT id, application_id, secret, created_at, expires_at
+		FROM application_secrets
+		WHERE application_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY created_at DESC`
+
+	rows, err := p.db.QueryContext(ctx, query, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var secrets []models.ApplicationSecret
+	for rows.Next() {
+		var secret models.ApplicationSecret
+		if err := rows.Scan(&secret.ID, &secret.ApplicationID, &secret.Secret, &secret.CreatedAt, &secret.ExpiresAt); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return secrets, rows.Err()
+}
+
+// RotateApplicationSecret adds a new secret to an application and schedules
+// its currently active secrets to expire at previousExpireAt
+func (p *PostgresDB) RotateApplicationSecret(ctx context.Context, applicationID, secret string, previousExpireAt time.Time) (*models.ApplicationSecret, error) {
+	ctx, end := p.operation(ctx, "RotateApplicationSecret")
+	defer end()
+
+	secretID, err := credentials.NewUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Secrets already due to expire sooner keep their earlier expiry
+	query := `UPDATE application_secrets
+		SET expires_at = $2
+		WHERE application_id = $1 AND (expires_at IS NULL OR expires_at > $2)`
+	if _, err := tx.ExecContext(ctx, query, applicationID, previousExpireAt); err != nil {
+		return nil, err
+	}
+
+	newSecret := models.ApplicationSecret{
+		ID:            secretID,
+		ApplicationID: applicationID,
+		Secret:        secret,
+	}
+	query = `INSERT INTO application_secrets (id, application_id, secret) VALUES ($1, $2, $3) RETURNING created_at`
+	if err := tx.QueryRowContext(ctx, query, secretID, applicationID, secret).Scan(&newSecret.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &newSecret, nil
+}
+
+// RecordApplicationUsage adds request counts to the daily usage of
+// applications and updates their last used time, in a single transaction.
+// Counts of applications deleted since are dropped.
+func (p *PostgresDB) RecordApplicationUsage(ctx context.Context, counts []UsageCount) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	ctx, end := p.operation(ctx, "RecordApplicationUsage")
+	defer end()
+
+	// Rows are written in a consistent order so that concurrent flushes of
+	// several instances cannot deadlock
+	sorted := append([]UsageCount(nil), counts...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ApplicationID != sorted[j].ApplicationID {
+			return sorted[i].ApplicationID < sorted[j].ApplicationID
+		}
+		return sorted[i].Day.Before(sorted[j].Day)
+	})
+
+	ids := make([]string, len(sorted))
+	days := make([]string, len(sorted))
+	requests := make([]int64, len(sorted))
+	lastUsed := make([]string, len(sorted))
+	for i, count := range sorted {
+		ids[i] = count.ApplicationID
+		days[i] = count.Day.Format("2006-01-02")
+		requests[i] = count.Requests
+		lastUsed[i] = count.LastUsedAt.Format(time.RFC3339Nano)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	usageQuery := `INSERT INTO application_usage (application_id, day, request_count)
+		SELECT u.id, u.day, u.requests
+		FROM unnest($1::uuid[], $2::date[], $3::bigint[]) AS u(id, day, requests)
+		JOIN applications a ON a.id = u.id
+		ORDER BY u.id, u.day
+		ON CONFLICT (application_id, day) DO UPDATE SET request_count = application_usage.request_count + EXCLUDED.request_count`
+
+	if _, err := tx.ExecContext(ctx, usageQuery, pq.Array(ids), pq.Array(days), pq.Array(requests)); err != nil {
+		return err
+	}
+
+	lastUsedQuery := `UPDATE applications a SET last_used_at = GREATEST(a.last_used_at, u.last_used_at)
+		FROM (
+			SELECT id, MAX(last_used_at) AS last_used_at
+			FROM unnest($1::uuid[], $2::timestamptz[]) AS u(id, last_used_at)
+			GROUP BY id
+		) u
+		WHERE a.id = u.id`
+
+	if _, err := tx.ExecContext(ctx, lastUsedQuery, pq.Array(ids), pq.Array(lastUsed)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetApplicationUsage retrieves the daily request counts of an application since the given day
+func (p *PostgresDB) GetApplicationUsage(ctx context.Context, applicationID string, since time.Time) ([]models.ApplicationUsage, error) {
+	ctx, end := p.operation(ctx, "GetApplicationUsage")
+	defer end()
+
+	query := `SELECT day, request_count FROM application_usage
+		WHERE application_id = $1 AND day >= $2
+		ORDER BY day`
+
+	rows, err := p.db.QueryContext(ctx, query, applicationID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []models.ApplicationUsage
+	for rows.Next() {
+		var u models.ApplicationUsage
+		if err := rows.Scan(&u.Day, &u.RequestCount); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+
+	return usage, rows.Err()
+}
+
+// scopesArray converts scopes to a Postgres array, storing nil as an empty array
+func scopesArray(scopes []string) interface{} {
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return pq.Array(scopes)
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+
+	"github.com/kevinmahoney/etrenank/internal/models"
+)
+
+// featureFlagColumns lists the columns scanned by scanFeatureFlag
+const featureFlagColumns = `name, description, enabled, rollout_percentage, created_at, updated_at`
+
+// scanFeatureFlag scans a row selected with featureFlagColumns
+func scanFeatureFlag(row scanner) (*models.FeatureFlag, error) {
+	flag := models.FeatureFlag{Overrides: make(map[string]bool)}
+	err := row.Scan(
+		&flag.Name, &flag.Description, &flag.Enabled, &flag.RolloutPercentage, &flag.CreatedAt, &flag.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+// ListFeatureFlags retrieves every feature flag along with its overrides
+func (p *PostgresDB) ListFeatureFlags(ctx context.Context) ([]models.FeatureFlag, error) {
+	ctx, end := p.operation(ctx, "ListFeatureFlags")
+	defer end()
+
+	query := `SELECT ` + featureFlagColumns + ` FROM feature_flags ORDER BY name`
+
+	rows, err := p.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []models.FeatureFlag{}
+	index := make(map[string]int)
+	for rows.Next() {
+		flag, err := scanFeatureFlag(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[flag.Name] = len(flags)
+		flags = append(flags, *flag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	overrides, err := p.db.QueryContext(ctx, `SELECT flag_name, application_id, enabled FROM feature_flag_overrides`)
+	if err != nil {
+		return nil, err
+	}
+	defer overrides.Close()
+
+	for overrides.Next() {
+		var name, applicationID string
+		var enabled bool
+		if err := overrides.Scan(&name, &applicationID, &enabled); err != nil {
+			return nil, err
+		}
+		if i, ok := index[name]; ok {
+			flags[i].Overrides[applicationID] = enabled
+		}
+	}
+
+	return flags, overrides.Err()
+}
+
+// GetFeatureFlag retrieves a feature flag by its name along with its overrides
+func (p *PostgresDB) GetFeatureFlag(ctx context.Context, name string) (*models.FeatureFlag, error) {
+	ctx, end := p.operation(ctx, "GetFeatureFlag")
+	defer end()
+
+	query := `SELECT ` + featureFlagColumns + ` FROM feature_flags WHERE name = $1`
+
+	flag, err := scanFeatureFlag(p.db.QueryRowContext(ctx, query, name))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.db.QueryContext(ctx, `SELECT application_id, enabled FROM feature_flag_overrides WHERE flag_name = $1`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var applicationID string
+		var enabled bool
+		if err := rows.Scan(&applicationID, &enabled); err != nil {
+			return nil, err
+		}
+		flag.Overrides[applicationID] = enabled
+	}
+
+	return flag, rows.Err()
+}
+
+// PutFeatureFlag creates a feature flag or updates it, keeping its overrides
+func (p *PostgresDB) PutFeatureFlag(ctx context.Context, flag *models.FeatureFlag) error {
+	ctx, end := p.operation(ctx, "PutFeatureFlag")
+	defer end()
+
+	query := `INSERT INTO feature_flags (name, description, enabled, rollout_percentage)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description, enabled = EXCLUDED.enabled,
+			rollout_percentage = EXCLUDED.rollout_percentage, updated_at = CURRENT_TIMESTAMP
+		RETURNING created_at, updated_at`
+
+	return p.db.QueryRowContext(ctx, query, flag.Name, flag.Description, flag.Enabled, flag.RolloutPercentage).
+		Scan(&flag.CreatedAt, &flag.UpdatedAt)
+}
+
+// DeleteFeatureFlag deletes a feature flag along with its overrides
+func (p *PostgresDB) DeleteFeatureFlag(ctx context.Context, name string) error {
+	ctx, end := p.operation(ctx, "DeleteFeatureFlag")
+	defer end()
+
+	query := `DELETE FROM feature_flags WHERE name = $1`
+
+	result, err := p.db.ExecContext(ctx, query, name)
+	if err != nil {
+		return err
+	}
+
+	return expectRowsAffected(result)
+}
+
+// SetFeatureFlagOverride turns a feature flag on or off for an application
+func (p *PostgresDB) SetFeatureFlagOverride(ctx context.Context, name, applicationID string, enabled bool) error {
+	ctx, end := p.operation(ctx, "SetFeatureFlagOverride")
+	defer end()
+
+	// Selecting the flag and the application inserts nothing if either is missing
+	query := `INSERT INTO feature_flag_overrides (flag_name, application_id, enabled)
+		SELECT f.name, a.id, $3 FROM feature_flags f, applications a
+		WHERE f.name = $1 AND a.id = $2
+		ON CONFLICT (flag_name, application_id) DO UPDATE SET enabled = EXCLUDED.enabled`
+
+	result, err := p.db.ExecContext(ctx, query, name, applicationID, enabled)
+	if err != nil {
+		return err
+	}
+
+	return expectRowsAffected(result)
+}
+
+// DeleteFeatureFlagOverride removes the override of a feature flag for an application
+func (p *PostgresDB) DeleteFeatureFlagOverride(ctx context.Context, name, applicationID string) error {
+	ctx, end := p.operation(ctx, "DeleteFeatureFlagOverride")
+	defer end()
+
+	query := `DELETE FROM feature_flag_overrides WHERE flag_name = $1 AND application_id = $2`
+
+	result, err := p.db.ExecContext(ctx, query, name, applicationID)
+	if err != nil {
+		return err
+	}
+
+	return expectRowsAffected(result)
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+
+	"github.com/kevinmahoney/etrenank/internal/models"
+)
+
+// SaveLocation adds a location to the saved locations of an application,
+// unless it already saved limit other locations. The application row is
+// locked so that concurrent saves cannot exceed the limit together.
+func (p *PostgresDB) SaveLocation(ctx context.Context, applicationID, zipCode string, limit int) error {
+	ctx, end := p.operation(ctx, "SaveLocation")
+	defer end()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id string
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM applications WHERE id = $1 FOR UPDATE`, applicationID).Scan(&id); err != nil {
+		return err
+	}
+
+	var saved, count int
+	query := `SELECT COUNT(*) FILTER (WHERE zip_code = $2), COUNT(*) FROM saved_locations WHERE application_id = $1`
+	if err := tx.QueryRowContext(ctx, query, applicationID, zipCode).Scan(&saved, &count); err != nil {
+		return err
+	}
+	if saved > 0 {
+		return nil
+	}
+	if count >= limit {
+		return ErrLimitExceeded
+	}
+
+	query = `INSERT INTO saved_locations (application_id, zip_code) VALUES ($1, $2)
+		ON CONFLICT (application_id, zip_code) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, query, applicationID, zipCode); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteSavedLocation removes a location from the saved locations of an application
+func (p *PostgresDB) DeleteSavedLocation(ctx context.Context, applicationID, zipCode string) error {
+	ctx, end := p.operation(ctx, "DeleteSavedLocation")
+	defer end()
+
+	query := `DELETE FROM saved_locations WHERE application_id = $1 AND zip_code = $2`
+
+	result, err := p.db.ExecContext(ctx, query, applicationID, zipCode)
+	if err != nil {
+		return err
+	}
+
+	return expectRowsAffected(result)
+}
+
+// ListSavedLocations retrieves the saved locations of an application
+func (p *PostgresDB) ListSavedLocations(ctx context.Context, applicationID string) ([]models.SavedLocation, error) {
+	ctx, end := p.operation(ctx, "ListSavedLocations")
+	defer end()
+
+	query := `SELECT zip_code, created_at FROM saved_locations
+		WHERE application_id = $1
+		ORDER BY zip_code`
+
+	rows, err := p.db.QueryContext(ctx, query, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []models.SavedLocation{}
+	for rows.Next() {
+		var location models.SavedLocation
+		if err := rows.Scan(&location.ZipCode, &location.CreatedAt); err != nil {
+			return nil, err
+		}
+		locations = append(locations, location)
+	}
+
+	return locations, rows.Err()
+}
+
+// ListSavedZipCodes retrieves every location saved by any enabled application
+func (p *PostgresDB) ListSavedZipCodes(ctx context.Context) ([]string, error) {
+	ctx, end := p.operation(ctx, "ListSavedZipCodes")
+	defer end()
+
+	query := `SELECT DISTINCT l.zip_code FROM saved_locations l
+		JOIN applications a ON a.id = l.application_id
+		WHERE a.enabled AND (a.expires_at IS NULL OR a.expires_at > NOW())`
+
+	rows, err := p.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var zipCodes []string
+	for rows.Next() {
+		var zipCode string
+		if err := rows.Scan(&zipCode); err != nil {
+			return nil, err
+		}
+		zipCodes = append(zipCodes, zipCode)
+	}
+
+	return zipCodes, rows.Err()
+}
@@ -0,0 +1,518 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/credentials"
+	"github.com/kevinmahoney/etrenank/internal/models"
+)
+
+// usageKey identifies the request count of an application on a single day
+type usageKey struct {
+	applicationID string
+	day           time.Time
+}
+
+// MemoryDB is a Repository held in process memory. Nothing is persisted, so
+// it suits tests and local development without Postgres.
+type MemoryDB struct {
+	mu           sync.RWMutex
+	applications map[string]*models.Application
+	secrets      map[string][]models.ApplicationSecret
+	usage        map[usageKey]int64
+	locations    map[string]map[string]time.Time
+	settings     string
+	featureFlags map[string]*models.FeatureFlag
+}
+
+// NewMemoryDB creates a new empty in-memory database
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		applications: make(map[string]*models.Application),
+		secrets:      make(map[string][]models.ApplicationSecret),
+		usage:        make(map[usageKey]int64),
+		locations:    make(map[string]map[string]time.Time),
+		featureFlags: make(map[string]*models.FeatureFlag),
+	}
+}
+
+// Ping always succeeds
+func (m *MemoryDB) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing
+func (m *MemoryDB) Close() error {
+	return nil
+}
+
+// GetApplicationByID retrieves an application by its ID
+func (m *MemoryDB) GetApplicationByID(ctx context.Context, id string) (*models.Application, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	app, ok := m.applications[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyApplication(app), nil
+}
+
+// GetApplicationByClientID retrieves an application by its client ID
+func (m *MemoryDB) GetApplicationByClientID(ctx context.Context, clientID string) (*models.Application, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, app := range m.applications {
+		if app.ClientID == clientID {
+			return copyApplication(app), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// CreateApplication creates a new application along with its initial secret
+func (m *MemoryDB) CreateApplication(ctx context.Context, app *models.Application) error {
+	secretID, err := credentials.NewUUID()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.applications[app.ID]; ok {
+		return ErrDuplicate
+	}
+	for _, existing := range m.applications {
+		if existing.ClientID == app.ClientID {
+			return ErrDuplicate
+		}
+	}
+
+	now := time.Now()
+	app.CreatedAt = now
+	app.UpdatedAt = now
+
+	stored := copyApplication(app)
+	stored.ClientSecret = ""
+	m.applications[app.ID] = stored
+	m.secrets[app.ID] = []models.ApplicationSecret{{
+		ID:            secretID,
+		ApplicationID: app.ID,
+		Secret:        app.ClientSecret,
+		CreatedAt:     now,
+	}}
+
+	return nil
+}
+
+// ListApplications retrieves a page of applications ordered by client ID.
+// A limit of zero or less returns every application after the offset.
+func (m *MemoryDB) ListApplications(ctx context.Context, limit, offset int) ([]models.Application, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	apps := make([]models.Application, 0, len(m.applications))
+	for _, app := range m.applications {
+		apps = append(apps, *copyApplication(app))
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].ClientID < apps[j].ClientID })
+
+	offset = min(max(offset, 0), len(apps))
+	apps = apps[offset:]
+	if limit > 0 && limit < len(apps) {
+		apps = apps[:limit]
+	}
+
+	return apps, nil
+}
+
+// CountApplications returns the total number of applications
+func (m *MemoryDB) CountApplications(ctx context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.applications), nil
+}
+
+// UpdateApplication updates the expiry, owner, plan, auth mode, rate limit and scopes of an application
+func (m *MemoryDB) UpdateApplication(ctx context.Context, app *models.Application) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.applications[app.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	updated := copyApplication(app)
+	stored.ExpiresAt = updated.ExpiresAt
+	stored.OwnerEmail = updated.OwnerEmail
+	stored.PlanTier = updated.PlanTier
+	stored.AuthMode = updated.AuthMode
+	stored.RateLimitPerMinute = updated.RateLimitPerMinute
+	stored.Scopes = updated.Scopes
+	stored.UpdatedAt = time.Now()
+
+	app.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+// SetApplicationEnabled enables or disables an application by its ID
+func (m *MemoryDB) SetApplicationEnabled(ctx context.Context, id string, enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	app, ok := m.applications[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	app.Enabled = enabled
+	app.UpdatedAt = time.Now()
+	return nil
+}
+
+// DeleteApplication deletes an application by its ID along with its secrets,
+// usage, saved locations and feature flag overrides
+func (m *MemoryDB) DeleteApplication(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.applications[id]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(m.applications, id)
+	delete(m.secrets, id)
+	delete(m.locations, id)
+	for key := range m.usage {
+		if key.applicationID == id {
+			delete(m.usage, key)
+		}
+	}
+	for _, flag := range m.featureFlags {
+		delete(flag.Overrides, id)
+	}
+
+	return nil
+}
+
+// GetActiveApplicationSecrets retrieves the secrets of an application that have not expired
+func (m *MemoryDB) GetActiveApplicationSecrets(ctx context.Context, applicationID string) ([]models.ApplicationSecret, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	stored := m.secrets[applicationID]
+
+	// Newest first, as secrets are appended in creation order
+	var secrets []models.ApplicationSecret
+	for i := len(stored) - 1; i >= 0; i-- {
+		if stored[i].ExpiresAt == nil || stored[i].ExpiresAt.After(now) {
+			secrets = append(secrets, stored[i])
+		}
+	}
+
+	return secrets, nil
+}
+
+// RotateApplicationSecret adds a new secret to an application and schedules
+// its currently active secrets to expire at previousExpireAt
+func (m *MemoryDB) RotateApplicationSecret(ctx context.Context, applicationID, secret string, previousExpireAt time.Time) (*models.ApplicationSecret, error) {
+	secretID, err := credentials.NewUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.applications[applicationID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	// Secrets already due to expire sooner keep their earlier expiry
+	secrets := m.secrets[applicationID]
+	for i := range secrets {
+		if secrets[i].ExpiresAt == nil || secrets[i].ExpiresAt.After(previousExpireAt) {
+			expireAt := previousExpireAt
+			secrets[i].ExpiresAt = &expireAt
+		}
+	}
+
+	newSecret := models.ApplicationSecret{
+		ID:            secretID,
+		ApplicationID: applicationID,
+		Secret:        secret,
+		CreatedAt:     time.Now(),
+	}
+	m.secrets[applicationID] = append(secrets, newSecret)
+
+	return &newSecret, nil
+}
+
+// RecordApplicationUsage adds request counts to the daily usage of
+// applications and updates their last used time
+func (m *MemoryDB) RecordApplicationUsage(ctx context.Context, counts []UsageCount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, count := range counts {
+		app, ok := m.applications[count.ApplicationID]
+		if !ok {
+			continue
+		}
+		if app.LastUsedAt == nil || count.LastUsedAt.After(*app.LastUsedAt) {
+			lastUsedAt := count.LastUsedAt
+			app.LastUsedAt = &lastUsedAt
+		}
+		m.usage[usageKey{applicationID: count.ApplicationID, day: truncateDay(count.Day)}] += count.Requests
+	}
+
+	return nil
+}
+
+// GetApplicationUsage retrieves the daily request counts of an application since the given day
+func (m *MemoryDB) GetApplicationUsage(ctx context.Context, applicationID string, since time.Time) ([]models.ApplicationUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	since = truncateDay(since)
+
+	var usage []models.ApplicationUsage
+	for key, count := range m.usage {
+		if key.applicationID == applicationID && !key.day.Before(since) {
+			usage = append(usage, models.ApplicationUsage{Day: key.day, RequestCount: count})
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Day.Before(usage[j].Day) })
+
+	return usage, nil
+}
+
+// SaveLocation adds a location to the saved locations of an application,
+// unless it already saved limit other locations
+func (m *MemoryDB) SaveLocation(ctx context.Context, applicationID, zipCode string, limit int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.applications[applicationID]; !ok {
+		return sql.ErrNoRows
+	}
+
+	locations, ok := m.locations[applicationID]
+	if !ok {
+		locations = make(map[string]time.Time)
+		m.locations[applicationID] = locations
+	}
+	if _, ok := locations[zipCode]; ok {
+		return nil
+	}
+	if len(locations) >= limit {
+		return ErrLimitExceeded
+	}
+	locations[zipCode] = time.Now()
+
+	return nil
+}
+
+// DeleteSavedLocation removes a location from the saved locations of an application
+func (m *MemoryDB) DeleteSavedLocation(ctx context.Context, applicationID, zipCode string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.locations[applicationID][zipCode]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(m.locations[applicationID], zipCode)
+	return nil
+}
+
+// ListSavedLocations retrieves the saved locations of an application
+func (m *MemoryDB) ListSavedLocations(ctx context.Context, applicationID string) ([]models.SavedLocation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	locations := []models.SavedLocation{}
+	for zipCode, createdAt := range m.locations[applicationID] {
+		locations = append(locations, models.SavedLocation{ZipCode: zipCode, CreatedAt: createdAt})
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].ZipCode < locations[j].ZipCode })
+
+	return locations, nil
+}
+
+// ListSavedZipCodes retrieves every location saved by any enabled application
+func (m *MemoryDB) ListSavedZipCodes(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	seen := make(map[string]bool)
+
+	var zipCodes []string
+	for applicationID, locations := range m.locations {
+		app, ok := m.applications[applicationID]
+		if !ok || !app.Enabled || app.IsExpired(now) {
+			continue
+		}
+		for zipCode := range locations {
+			if !seen[zipCode] {
+				seen[zipCode] = true
+				zipCodes = append(zipCodes, zipCode)
+			}
+		}
+	}
+
+	return zipCodes, nil
+}
+
+// copyApplication returns a copy of an application that shares no pointers with it
+func copyApplication(app *models.Application) *models.Application {
+	c := *app
+	if app.ExpiresAt != nil {
+		expiresAt := *app.ExpiresAt
+		c.ExpiresAt = &expiresAt
+	}
+	if app.LastUsedAt != nil {
+		lastUsedAt := *app.LastUsedAt
+		c.LastUsedAt = &lastUsedAt
+	}
+	if app.Scopes != nil {
+		c.Scopes = append([]string{}, app.Scopes...)
+	} else {
+		c.Scopes = []string{}
+	}
+	return &c
+}
+
+// truncateDay returns midnight UTC of the day of t
+func truncateDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// GetRuntimeSettings retrieves the runtime settings document
+func (m *MemoryDB) GetRuntimeSettings(ctx context.Context) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.settings == "" {
+		return "", sql.ErrNoRows
+	}
+	return m.settings, nil
+}
+
+// PutRuntimeSettings replaces the runtime settings document
+func (m *MemoryDB) PutRuntimeSettings(ctx context.Context, document string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.settings = document
+	return nil
+}
+
+// ListFeatureFlags retrieves every feature flag along with its overrides
+func (m *MemoryDB) ListFeatureFlags(ctx context.Context) ([]models.FeatureFlag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	flags := make([]models.FeatureFlag, 0, len(m.featureFlags))
+	for _, flag := range m.featureFlags {
+		flags = append(flags, *copyFeatureFlag(flag))
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags, nil
+}
+
+// GetFeatureFlag retrieves a feature flag by its name along with its overrides
+func (m *MemoryDB) GetFeatureFlag(ctx context.Context, name string) (*models.FeatureFlag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	flag, ok := m.featureFlags[name]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyFeatureFlag(flag), nil
+}
+
+// PutFeatureFlag creates a feature flag or updates it, keeping its overrides
+func (m *MemoryDB) PutFeatureFlag(ctx context.Context, flag *models.FeatureFlag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	stored := copyFeatureFlag(flag)
+	stored.Overrides = make(map[string]bool)
+	stored.CreatedAt, stored.UpdatedAt = now, now
+	if existing, ok := m.featureFlags[flag.Name]; ok {
+		stored.Overrides = existing.Overrides
+		stored.CreatedAt = existing.CreatedAt
+	}
+	m.featureFlags[flag.Name] = stored
+
+	flag.CreatedAt, flag.UpdatedAt = stored.CreatedAt, stored.UpdatedAt
+	return nil
+}
+
+// DeleteFeatureFlag deletes a feature flag along with its overrides
+func (m *MemoryDB) DeleteFeatureFlag(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.featureFlags[name]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(m.featureFlags, name)
+	return nil
+}
+
+// SetFeatureFlagOverride turns a feature flag on or off for an application
+func (m *MemoryDB) SetFeatureFlagOverride(ctx context.Context, name, applicationID string, enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	flag, ok := m.featureFlags[name]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := m.applications[applicationID]; !ok {
+		return sql.ErrNoRows
+	}
+	flag.Overrides[applicationID] = enabled
+	return nil
+}
+
+// DeleteFeatureFlagOverride removes the override of a feature flag for an application
+func (m *MemoryDB) DeleteFeatureFlagOverride(ctx context.Context, name, applicationID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	flag, ok := m.featureFlags[name]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := flag.Overrides[applicationID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(flag.Overrides, applicationID)
+	return nil
+}
+
+// copyFeatureFlag returns a copy of a feature flag that shares no maps with it
+func copyFeatureFlag(flag *models.FeatureFlag) *models.FeatureFlag {
+	c := *flag
+	c.Overrides = make(map[string]bool, len(flag.Overrides))
+	for applicationID, enabled := range flag.Overrides {
+		c.Overrides[applicationID] = enabled
+	}
+	return &c
+}
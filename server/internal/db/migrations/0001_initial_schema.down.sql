@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS saved_locations;
+DROP TABLE IF EXISTS application_usage;
+DROP TABLE IF EXISTS application_secrets;
+DROP TABLE IF EXISTS applications;
@@ -0,0 +1,82 @@
+-- Initial schema. Tables are created only if missing, and the columns added
+-- since are added if missing, so that databases created by the former
+-- scripts/init-db.sql are upgraded in place. Their client secrets are moved
+-- to application_secrets by migration 0004.
+
+-- Create applications table
+CREATE TABLE IF NOT EXISTS applications (
+    id UUID PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL UNIQUE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    owner_email VARCHAR(255) NOT NULL DEFAULT '',
+    plan_tier VARCHAR(32) NOT NULL DEFAULT 'free',
+    auth_mode VARCHAR(16) NOT NULL DEFAULT 'secret',
+    rate_limit_per_minute INTEGER NOT NULL DEFAULT 0,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Upgrade applications tables created by scripts/init-db.sql, which only
+-- had the id, client_id, client_secret and timestamp columns
+ALTER TABLE applications
+    ADD COLUMN IF NOT EXISTS enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS owner_email VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS plan_tier VARCHAR(32) NOT NULL DEFAULT 'free',
+    ADD COLUMN IF NOT EXISTS auth_mode VARCHAR(16) NOT NULL DEFAULT 'secret',
+    ADD COLUMN IF NOT EXISTS rate_limit_per_minute INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+-- Applications are now created without client_secret, whose values are kept
+-- until migration 0004 moves them to application_secrets
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'applications' AND column_name = 'client_secret'
+    ) THEN
+        ALTER TABLE applications ALTER COLUMN client_secret DROP NOT NULL;
+    END IF;
+END $$;
+
+-- Create index on client_id for faster lookups
+CREATE INDEX IF NOT EXISTS idx_applications_client_id ON applications(client_id);
+
+-- Create application secrets table; an application may have several active
+-- secrets at once so that a rotated secret keeps working for a grace period
+CREATE TABLE IF NOT EXISTS application_secrets (
+    id UUID PRIMARY KEY,
+    application_id UUID NOT NULL REFERENCES applications(id) ON DELETE CASCADE,
+    secret VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create index on application_id for faster secret lookups
+CREATE INDEX IF NOT EXISTS idx_application_secrets_application_id ON application_secrets(application_id);
+
+-- Create application usage table holding daily request counts per application
+CREATE TABLE IF NOT EXISTS application_usage (
+    application_id UUID NOT NULL REFERENCES applications(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    request_count BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (application_id, day)
+);
+
+-- Create saved locations table holding the locations each application follows;
+-- their scores are pre-warmed ahead of sunrise and sunset
+CREATE TABLE IF NOT EXISTS saved_locations (
+    application_id UUID NOT NULL REFERENCES applications(id) ON DELETE CASCADE,
+    zip_code VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (application_id, zip_code)
+);
+
+-- Create index on zip_code for listing distinct saved locations
+CREATE INDEX IF NOT EXISTS idx_saved_locations_zip_code ON saved_locations(zip_code);
@@ -0,0 +1,7 @@
+-- Runtime settings document, read by the API when RUNTIME_SETTINGS_DATABASE
+-- is enabled. It holds a single row so that a change is applied atomically.
+CREATE TABLE runtime_settings (
+    id SMALLINT PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    document JSONB NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
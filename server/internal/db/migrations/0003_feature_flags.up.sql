@@ -0,0 +1,20 @@
+-- Feature flags, evaluated per application. A flag is on for the share of
+-- applications given by its rollout percentage, unless an application has an
+-- override.
+CREATE TABLE feature_flags (
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    rollout_percentage SMALLINT NOT NULL DEFAULT 100 CHECK (rollout_percentage BETWEEN 0 AND 100),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Turns a flag on or off for a single application, regardless of its rollout
+CREATE TABLE feature_flag_overrides (
+    flag_name VARCHAR(64) NOT NULL REFERENCES feature_flags(name) ON DELETE CASCADE,
+    application_id UUID NOT NULL REFERENCES applications(id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (flag_name, application_id)
+);
@@ -0,0 +1,10 @@
+-- Restore applications.client_secret with the latest secret of each
+-- application; the secrets are kept in application_secrets too
+ALTER TABLE applications ADD COLUMN IF NOT EXISTS client_secret VARCHAR(255);
+
+UPDATE applications a SET client_secret = (
+    SELECT s.secret FROM application_secrets s
+    WHERE s.application_id = a.id
+    ORDER BY s.created_at DESC
+    LIMIT 1
+);
@@ -0,0 +1,24 @@
+-- Move the client secrets of applications created by the former
+-- scripts/init-db.sql from applications.client_secret to
+-- application_secrets, where authentication looks them up. Secrets are
+-- copied as is: HMAC signing needs the secret itself, so they are stored in
+-- the clear like every secret in application_secrets.
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'applications' AND column_name = 'client_secret'
+    ) THEN
+        INSERT INTO application_secrets (id, application_id, secret, created_at)
+        SELECT md5(random()::text || clock_timestamp()::text || a.id::text)::uuid, a.id, a.client_secret,
+            COALESCE(a.created_at, CURRENT_TIMESTAMP)
+        FROM applications a
+        WHERE a.client_secret IS NOT NULL AND a.client_secret <> ''
+            AND NOT EXISTS (
+                SELECT 1 FROM application_secrets s
+                WHERE s.application_id = a.id AND s.secret = a.client_secret
+            );
+
+        ALTER TABLE applications DROP COLUMN client_secret;
+    END IF;
+END $$;
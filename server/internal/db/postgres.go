@@ -1,36 +1,98 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
 
-	_ "github.com/lib/pq"
 	"github.com/kevinmahoney/etrenank/internal/config"
-	"github.com/kevinmahoney/etrenank/internal/models"
+	"github.com/kevinmahoney/etrenank/internal/tracing"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // PostgresDB represents a PostgreSQL database connection
 type PostgresDB struct {
-	db *sql.DB
+	db           *sql.DB
+	queryTimeout time.Duration
 }
 
 // NewPostgresDB creates a new PostgreSQL database connection
 func NewPostgresDB(cfg config.DatabaseConfig) (*PostgresDB, error) {
-	connStr := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName,
-	)
-
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", connectionString(cfg))
 	if err != nil {
 		return nil, err
 	}
 
-	if err := db.Ping(); err != nil {
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	return &PostgresDB{db: db}, nil
+	return &PostgresDB{db: db, queryTimeout: cfg.QueryTimeout}, nil
+}
+
+// connectionString builds a libpq connection URL, escaping credentials and
+// database names that contain spaces or reserved characters
+func connectionString(cfg config.DatabaseConfig) string {
+	query := url.Values{}
+	query.Set("sslmode", cfg.SSLMode)
+	if cfg.SSLRootCert != "" {
+		query.Set("sslrootcert", cfg.SSLRootCert)
+	}
+	if cfg.ConnectTimeout > 0 {
+		query.Set("connect_timeout", strconv.Itoa(int(cfg.ConnectTimeout.Seconds())))
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Path:     "/" + cfg.DBName,
+		RawQuery: query.Encode(),
+	}
+	return dsn.String()
+}
+
+// Stats returns the connection pool statistics
+func (p *PostgresDB) Stats() sql.DBStats {
+	return p.db.Stats()
+}
+
+// operation starts a span for a database operation and bounds it by the
+// configured query timeout, if any. The returned function ends both.
+func (p *PostgresDB) operation(ctx context.Context, name string) (context.Context, func()) {
+	ctx, span := tracing.Start(ctx, "postgres."+name, attribute.String("db.system", "postgresql"))
+
+	cancel := context.CancelFunc(func() {})
+	if p.queryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.queryTimeout)
+	}
+
+	return ctx, func() {
+		cancel()
+		span.End()
+	}
+}
+
+// Ping checks that the database is reachable
+func (p *PostgresDB) Ping(ctx context.Context) error {
+	ctx, end := p.operation(ctx, "Ping")
+	defer end()
+
+	return p.db.PingContext(ctx)
 }
 
 // Close closes the database connection
@@ -38,31 +100,28 @@ func (p *PostgresDB) Close() error {
 	return p.db.Close()
 }
 
-// GetApplicationByClientID retrieves an application by its client ID
-func (p *PostgresDB) GetApplicationByClientID(clientID string) (*models.Application, error) {
-	query := `SELECT id, client_id, client_secret FROM applications WHERE client_id = $1`
-	
-	var app models.Application
-	err := p.db.QueryRow(query, clientID).Scan(&app.ID, &app.ClientID, &app.ClientSecret)
-	if err != nil {
-		return nil, err
-	}
-	
-	return &app, nil
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
 }
 
-// CreateApplication creates a new application
-func (p *PostgresDB) CreateApplication(app *models.Application) error {
-	query := `INSERT INTO applications (id, client_id, client_secret) VALUES ($1, $2, $3)`
-	
-	_, err := p.db.Exec(query, app.ID, app.ClientID, app.ClientSecret)
-	return err
+// expectRowsAffected returns sql.ErrNoRows if a statement did not affect any row
+func expectRowsAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-// DeleteApplication deletes an application by its ID
-func (p *PostgresDB) DeleteApplication(id string) error {
-	query := `DELETE FROM applications WHERE id = $1`
-	
-	_, err := p.db.Exec(query, id)
-	return err
+// IsUniqueViolation reports whether err was caused by a unique constraint violation
+func IsUniqueViolation(err error) bool {
+	if errors.Is(err, ErrDuplicate) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
 }
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/models"
+)
+
+// ErrDuplicate is returned by repositories when a write would violate a
+// unique constraint, such as creating two applications with the same client ID
+var ErrDuplicate = errors.New("duplicate key")
+
+// ErrLimitExceeded is returned by repositories when a write would exceed a
+// limit, such as saving more locations than an application may save
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// UsageCount is a number of requests an application made on a day, to be
+// added to its usage
+type UsageCount struct {
+	ApplicationID string
+	Day           time.Time
+	Requests      int64
+	// LastUsedAt is when the last of the requests was made
+	LastUsedAt time.Time
+}
+
+// ApplicationRepository stores applications, their secrets and their usage.
+// Lookups and writes of a missing application return sql.ErrNoRows.
+type ApplicationRepository interface {
+	GetApplicationByID(ctx context.Context, id string) (*models.Application, error)
+	GetApplicationByClientID(ctx context.Context, clientID string) (*models.Application, error)
+	CreateApplication(ctx context.Context, app *models.Application) error
+	ListApplications(ctx context.Context, limit, offset int) ([]models.Application, error)
+	CountApplications(ctx context.Context) (int, error)
+	UpdateApplication(ctx context.Context, app *models.Application) error
+	SetApplicationEnabled(ctx context.Context, id string, enabled bool) error
+	DeleteApplication(ctx context.Context, id string) error
+
+	GetActiveApplicationSecrets(ctx context.Context, applicationID string) ([]models.ApplicationSecret, error)
+	RotateApplicationSecret(ctx context.Context, applicationID, secret string, previousExpireAt time.Time) (*models.ApplicationSecret, error)
+
+	RecordApplicationUsage(ctx context.Context, counts []UsageCount) error
+	GetApplicationUsage(ctx context.Context, applicationID string, since time.Time) ([]models.ApplicationUsage, error)
+}
+
+// LocationRepository stores the locations saved by applications
+type LocationRepository interface {
+	// SaveLocation saves a location unless the application already saved
+	// limit other locations, in which case it returns ErrLimitExceeded
+	SaveLocation(ctx context.Context, applicationID, zipCode string, limit int) error
+	DeleteSavedLocation(ctx context.Context, applicationID, zipCode string) error
+	ListSavedLocations(ctx context.Context, applicationID string) ([]models.SavedLocation, error)
+	ListSavedZipCodes(ctx context.Context) ([]string, error)
+}
+
+// SettingsRepository stores the runtime settings document. Reading a
+// missing document returns sql.ErrNoRows.
+type SettingsRepository interface {
+	GetRuntimeSettings(ctx context.Context) (string, error)
+	PutRuntimeSettings(ctx context.Context, document string) error
+}
+
+// FeatureFlagRepository stores feature flags and their per-application
+// overrides. Lookups and writes of a missing flag or application return
+// sql.ErrNoRows.
+type FeatureFlagRepository interface {
+	ListFeatureFlags(ctx context.Context) ([]models.FeatureFlag, error)
+	GetFeatureFlag(ctx context.Context, name string) (*models.FeatureFlag, error)
+	PutFeatureFlag(ctx context.Context, flag *models.FeatureFlag) error
+	DeleteFeatureFlag(ctx context.Context, name string) error
+
+	SetFeatureFlagOverride(ctx context.Context, name, applicationID string, enabled bool) error
+	DeleteFeatureFlagOverride(ctx context.Context, name, applicationID string) error
+}
+
+// Repository gives access to every table. It is implemented by PostgresDB
+// and by MemoryDB.
+type Repository interface {
+	ApplicationRepository
+	LocationRepository
+	SettingsRepository
+	FeatureFlagRepository
+	// Ping checks that the database is reachable
+	Ping(ctx context.Context) error
+	Close() error
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+)
+
+// GetRuntimeSettings retrieves the runtime settings document as JSON
+func (p *PostgresDB) GetRuntimeSettings(ctx context.Context) (string, error) {
+	ctx, end := p.operation(ctx, "GetRuntimeSettings")
+	defer end()
+
+	query := `SELECT document FROM runtime_settings WHERE id = 1`
+
+	var document string
+	err := p.db.QueryRowContext(ctx, query).Scan(&document)
+	return document, err
+}
+
+// PutRuntimeSettings replaces the runtime settings document
+func (p *PostgresDB) PutRuntimeSettings(ctx context.Context, document string) error {
+	ctx, end := p.operation(ctx, "PutRuntimeSettings")
+	defer end()
+
+	query := `INSERT INTO runtime_settings (id, document, updated_at) VALUES (1, $1, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET document = EXCLUDED.document, updated_at = EXCLUDED.updated_at`
+
+	_, err := p.db.ExecContext(ctx, query, document)
+	return err
+}
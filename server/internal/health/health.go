@@ -0,0 +1,114 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Statuses
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFailed   = "failed"
+)
+
+// Check checks that a dependency is usable
+type Check struct {
+	Name string
+	// Critical checks make the service not ready when they fail; other
+	// checks only report it as degraded
+	Critical bool
+	Run      func(ctx context.Context) error
+	// State optionally describes the dependency, such as the state of its circuit breaker
+	State func() string
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	State     string  `json:"state,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of every check
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready reports whether every critical check succeeded
+func (r Report) Ready() bool {
+	return r.Status != StatusFailed
+}
+
+// Checker runs checks concurrently, each bounded by a timeout so that a
+// hanging dependency cannot stall the probe
+type Checker struct {
+	timeout time.Duration
+	checks  []Check
+}
+
+// NewChecker creates a checker
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{timeout: timeout, checks: checks}
+}
+
+// Run runs every check and reports their outcome
+func (c *Checker) Run(ctx context.Context) Report {
+	results := make([]Result, len(c.checks))
+
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+	for i, check := range c.checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		if result.Status == StatusFailed {
+			if check.Critical {
+				report.Status = StatusFailed
+			} else if report.Status == StatusOK {
+				report.Status = StatusDegraded
+			}
+		}
+	}
+	return report
+}
+
+// run runs a check within the timeout
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Run(ctx)
+	if err == nil {
+		// Checks that ignore their context are still reported as failed
+		// once they overrun the timeout
+		err = ctx.Err()
+	}
+
+	result := Result{
+		Status:    StatusOK,
+		Critical:  check.Critical,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if check.State != nil {
+		result.State = check.State()
+	}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,150 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Component is a part of the service, such as a connection, a background
+// worker or the HTTP server, that is started and stopped with it
+type Component struct {
+	Name string
+	// Run runs the component until its context is cancelled, returning nil
+	// once it has stopped normally. Components without Run, such as
+	// connections, are only stopped. A component returning while the
+	// service runs shuts the service down.
+	Run func(ctx context.Context) error
+	// Stop stops the component, waiting for its in-flight work until ctx
+	// expires. It is called after the context of Run is cancelled.
+	Stop func(ctx context.Context) error
+	// Timeout bounds how long the component may take to stop; it must be positive
+	Timeout time.Duration
+}
+
+// component is a component added to a manager
+type component struct {
+	Component
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+	// failed is set once the error of Run is reported
+	failed  bool
+	stopped bool
+}
+
+// Manager starts components in the order they are added and stops them in
+// the reverse order, so that components are stopped before those they
+// depend on
+type Manager struct {
+	components []*component
+}
+
+// NewManager creates a new lifecycle manager without any component
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Add adds a component. Components must be added before Run.
+func (m *Manager) Add(c Component) {
+	m.components = append(m.components, &component{Component: c})
+}
+
+// Run starts every component and runs them until ctx is cancelled or a
+// component returns, then stops every component. It returns the errors of
+// the components that failed while running or stopping.
+func (m *Manager) Run(ctx context.Context) error {
+	exits := make(chan *component, len(m.components))
+	for _, c := range m.components {
+		if c.Run == nil {
+			continue
+		}
+
+		// Components run until they are stopped, not until ctx is cancelled,
+		// so that they stop in order
+		var runCtx context.Context
+		runCtx, c.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		c.done = make(chan struct{})
+		go func(c *component) {
+			defer close(c.done)
+			c.err = c.Run(runCtx)
+			exits <- c
+		}(c)
+	}
+
+	var errs []error
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down")
+	case c := <-exits:
+		err := c.err
+		if err == nil {
+			err = errors.New("stopped unexpectedly")
+		}
+		c.failed = true
+		slog.Error("Component failed, shutting down", "component", c.Name, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %v", c.Name, err))
+	}
+
+	if err := m.Stop(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Stop stops every component that is not stopped yet, in the reverse order
+// they were added. It may be called without Run to release the components
+// added so far, such as when the service fails to start.
+func (m *Manager) Stop() error {
+	var errs []error
+	for i := len(m.components) - 1; i >= 0; i-- {
+		c := m.components[i]
+		if c.stopped {
+			continue
+		}
+		c.stopped = true
+
+		if err := c.stop(); err != nil {
+			slog.Error("Failed to stop component", "component", c.Name, "error", err)
+			errs = append(errs, fmt.Errorf("failed to stop %s: %v", c.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// stop cancels the component, stops it and waits for Run to return, all
+// within the timeout of the component
+func (c *component) stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	var err error
+	if c.Stop != nil {
+		err = c.Stop(ctx)
+	}
+
+	if c.done != nil {
+		select {
+		case <-c.done:
+			if err == nil && !c.failed {
+				err = c.err
+			}
+		case <-ctx.Done():
+			if err == nil {
+				err = fmt.Errorf("did not stop within %s", c.Timeout)
+			}
+		}
+	}
+
+	if err == nil {
+		slog.Info("Stopped component", "component", c.Name, "duration_ms", time.Since(start).Milliseconds())
+	}
+	return err
+}
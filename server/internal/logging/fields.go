@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Request fields
+const (
+	FieldRequestID       = "request_id"
+	FieldApplicationID   = "application_id"
+	FieldCache           = "cache"
+	FieldUpstreamLatency = "upstream_latency_ms"
+)
+
+// fieldsKey is the context key of the request fields
+type fieldsKey struct{}
+
+// fields holds attributes added to every log line of a request. Layers deep
+// in the call stack set them, and the access log reports them once the
+// request completes.
+type fields struct {
+	mu     sync.Mutex
+	keys   []string
+	values map[string]slog.Value
+}
+
+// WithRequestID returns a context holding request fields, starting with the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	f := &fields{values: make(map[string]slog.Value)}
+	f.set(FieldRequestID, slog.StringValue(requestID))
+	return context.WithValue(ctx, fieldsKey{}, f)
+}
+
+// Set sets a request field. It does nothing if the context holds no request fields.
+func Set(ctx context.Context, key string, value any) {
+	if f := fieldsFrom(ctx); f != nil {
+		f.set(key, slog.AnyValue(value))
+	}
+}
+
+// fieldsFrom returns the request fields held by the context, if any
+func fieldsFrom(ctx context.Context) *fields {
+	f, _ := ctx.Value(fieldsKey{}).(*fields)
+	return f
+}
+
+// set sets a field, keeping fields in the order they were first set
+func (f *fields) set(key string, value slog.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.values[key]; !ok {
+		f.keys = append(f.keys, key)
+	}
+	f.values[key] = value
+}
+
+// attrs returns the fields as attributes
+func (f *fields) attrs() []slog.Attr {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	attrs := make([]slog.Attr, 0, len(f.keys))
+	for _, key := range f.keys {
+		attrs = append(attrs, slog.Attr{Key: key, Value: f.values[key]})
+	}
+	return attrs
+}
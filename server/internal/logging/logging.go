@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// redacted replaces secret values in log output
+const redacted = "[REDACTED]"
+
+// Setup installs the default slog logger, which is also used by the log
+// package. Every occurrence of the given secrets is redacted from messages
+// and attributes, including errors.
+func Setup(w io.Writer, cfg config.LogConfig, secrets ...string) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %v", cfg.Level, err)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: newRedactor(secrets).replaceAttr,
+	}
+
+	var handler slog.Handler
+	switch cfg.Format {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	logger := slog.New(&contextHandler{Handler: handler})
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// redactor replaces secret values in log attributes
+type redactor struct {
+	replacer *strings.Replacer
+}
+
+// newRedactor creates a redactor for the non-empty secrets
+func newRedactor(secrets []string) *redactor {
+	var pairs []string
+	for _, secret := range secrets {
+		if secret != "" {
+			pairs = append(pairs, secret, redacted)
+		}
+	}
+	if len(pairs) == 0 {
+		return &redactor{}
+	}
+	return &redactor{replacer: strings.NewReplacer(pairs...)}
+}
+
+// replaceAttr redacts secrets from string and error attributes
+func (r *redactor) replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if r.replacer == nil {
+		return a
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(r.replacer.Replace(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(r.replacer.Replace(err.Error()))
+		}
+	}
+	return a
+}
+
+// contextHandler adds the request fields and trace ID held by the context to
+// every record logged with a context
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle implements slog.Handler
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if fields := fieldsFrom(ctx); fields != nil {
+		record.AddAttrs(fields.attrs()...)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		record.AddAttrs(slog.String("trace_id", spanContext.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs implements slog.Handler
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
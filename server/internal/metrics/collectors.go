@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/kevinmahoney/etrenank/internal/services/cache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cacheRequestsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "requests_total"),
+		"Cache lookups by cache, tier and result. The shared tier is the configured cache store.",
+		[]string{"cache", "tier", "result"}, nil,
+	)
+	cacheLocalEntriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "local_entries"),
+		"Number of entries held in the in-process tier of a cache.",
+		[]string{"cache"}, nil,
+	)
+
+	dbOpenConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "open_connections"),
+		"Number of open database connections by state.",
+		[]string{"state"}, nil,
+	)
+	dbMaxOpenConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "max_open_connections"),
+		"Maximum number of open database connections; zero means unlimited.",
+		nil, nil,
+	)
+	dbWaitCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "wait_count_total"),
+		"Number of times a query waited for a free database connection.",
+		nil, nil,
+	)
+	dbWaitDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "wait_duration_seconds_total"),
+		"Total time spent waiting for a free database connection.",
+		nil, nil,
+	)
+	dbClosedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "closed_connections_total"),
+		"Number of database connections closed by reason.",
+		[]string{"reason"}, nil,
+	)
+)
+
+// cacheCollector collects the statistics of a tiered cache on each scrape
+type cacheCollector struct {
+	name  string
+	stats func() cache.Stats
+}
+
+// Describe implements prometheus.Collector
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheRequestsDesc
+	ch <- cacheLocalEntriesDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+
+	for tier, s := range map[string]cache.TierStats{"local": stats.Local, "shared": stats.Shared} {
+		ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(s.Hits), c.name, tier, "hit")
+		ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(s.Misses), c.name, tier, "miss")
+	}
+	ch <- prometheus.MustNewConstMetric(cacheLocalEntriesDesc, prometheus.GaugeValue, float64(stats.LocalSize), c.name)
+}
+
+// dbCollector collects database connection pool statistics on each scrape
+type dbCollector struct {
+	stats func() sql.DBStats
+}
+
+// Describe implements prometheus.Collector
+func (c *dbCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbOpenConnectionsDesc
+	ch <- dbMaxOpenConnectionsDesc
+	ch <- dbWaitCountDesc
+	ch <- dbWaitDurationDesc
+	ch <- dbClosedDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *dbCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+
+	ch <- prometheus.MustNewConstMetric(dbOpenConnectionsDesc, prometheus.GaugeValue, float64(stats.InUse), "in_use")
+	ch <- prometheus.MustNewConstMetric(dbOpenConnectionsDesc, prometheus.GaugeValue, float64(stats.Idle), "idle")
+	ch <- prometheus.MustNewConstMetric(dbMaxOpenConnectionsDesc, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbWaitCountDesc, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbWaitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(dbClosedDesc, prometheus.CounterValue, float64(stats.MaxIdleClosed), "max_idle")
+	ch <- prometheus.MustNewConstMetric(dbClosedDesc, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed), "max_idle_time")
+	ch <- prometheus.MustNewConstMetric(dbClosedDesc, prometheus.CounterValue, float64(stats.MaxLifetimeClosed), "max_lifetime")
+}
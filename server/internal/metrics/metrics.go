@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/kevinmahoney/etrenank/internal/services/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of every metric
+const namespace = "etrenank"
+
+// Registry holds every collector exposed by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequestDuration observes the latency of HTTP requests by route template and status
+	HTTPRequestDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// UpstreamRequestDuration observes the latency of calls to upstream providers
+	UpstreamRequestDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of upstream provider calls by provider and status code, or \"error\" if no response was received.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"provider", "status"})
+
+	// UpstreamErrors counts failed calls to upstream providers by reason
+	UpstreamErrors = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "errors_total",
+		Help:      "Failed upstream provider calls by provider and reason.",
+	}, []string{"provider", "reason"})
+
+	// UpstreamRetries counts retried calls to upstream providers by the reason of the retry
+	UpstreamRetries = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "retries_total",
+		Help:      "Retried upstream provider calls by provider and reason.",
+	}, []string{"provider", "reason"})
+
+	// UpstreamCircuitState reports the state of the circuit breaker of each upstream provider
+	UpstreamCircuitState = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "circuit_state",
+		Help:      "State of the circuit breaker of upstream providers: 1 for the current state (closed, half-open or open), 0 otherwise.",
+	}, []string{"provider", "state"})
+
+	// UpstreamCalls reports the calls made to upstream providers in the current budget period, across every instance
+	UpstreamCalls = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "calls",
+		Help:      "Calls made to upstream providers in the current UTC day or month, across every instance.",
+	}, []string{"provider", "period"})
+
+	// UpstreamBudget reports the call budget of upstream providers
+	UpstreamBudget = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "budget",
+		Help:      "Call budget of upstream providers per UTC day or month.",
+	}, []string{"provider", "period"})
+
+	// UpstreamBudgetExhausted reports whether calls to an upstream provider are refused to stay within budget
+	UpstreamBudgetExhausted = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "budget_exhausted",
+		Help:      "1 while calls to an upstream provider are refused and only cached values are served to stay within budget.",
+	}, []string{"provider"})
+
+	// SettingsReloads counts reloads of the runtime settings by result
+	SettingsReloads = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "settings",
+		Name:      "reloads_total",
+		Help:      "Reloads of the runtime settings that changed them (success) or were rejected (failure).",
+	}, []string{"result"})
+
+	// SunsetQualityScore observes the distribution of computed quality scores
+	SunsetQualityScore = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "sunset",
+		Name:      "quality_score",
+		Help:      "Distribution of computed sunset quality scores by scoring model version.",
+		Buckets:   prometheus.LinearBuckets(10, 10, 10),
+	}, []string{"model_version"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterCacheStats exposes the hit and miss counts of a tiered cache
+func RegisterCacheStats(name string, stats func() cache.Stats) {
+	Registry.MustRegister(&cacheCollector{name: name, stats: stats})
+}
+
+// RegisterDBStats exposes the connection pool statistics of a database
+func RegisterDBStats(stats func() sql.DBStats) {
+	Registry.MustRegister(&dbCollector{stats: stats})
+}
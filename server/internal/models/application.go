@@ -1,8 +1,78 @@
 package models
 
+import "time"
+
+// Scopes an application can be granted
+const (
+	ScopeSunsetQuality = "sunset_quality"
+	ScopeRotateSecrets = "secrets:rotate"
+)
+
+// Auth modes an application can authenticate with
+const (
+	// AuthModeSecret sends the client secret with every request
+	AuthModeSecret = "secret"
+	// AuthModeHMAC signs every request with the client secret
+	AuthModeHMAC = "hmac"
+)
+
+// Plan tiers an application can be on
+const (
+	PlanTierFree       = "free"
+	PlanTierPro        = "pro"
+	PlanTierEnterprise = "enterprise"
+)
+
+// KnownScopes lists every scope an application can be granted
+var KnownScopes = []string{ScopeSunsetQuality, ScopeRotateSecrets}
+
 // Application represents an API client application
 type Application struct {
-	ID           string `json:"id"`
-	ClientID     string `json:"client_id"`
-	ClientSecret string `json:"client_secret,omitempty"`
+	ID                 string     `json:"id"`
+	ClientID           string     `json:"client_id"`
+	ClientSecret       string     `json:"client_secret,omitempty"`
+	Enabled            bool       `json:"enabled"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+	OwnerEmail         string     `json:"owner_email"`
+	PlanTier           string     `json:"plan_tier"`
+	AuthMode           string     `json:"auth_mode"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute"`
+	Scopes             []string   `json:"scopes"`
+	LastUsedAt         *time.Time `json:"last_used_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// IsExpired reports whether the application has expired at the given time
+func (a *Application) IsExpired(now time.Time) bool {
+	return a.ExpiresAt != nil && !now.Before(*a.ExpiresAt)
+}
+
+// HasScope reports whether the application was granted a scope.
+// Applications without any scopes are granted every scope.
+func (a *Application) HasScope(scope string) bool {
+	if len(a.Scopes) == 0 {
+		return true
+	}
+	for _, s := range a.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplicationSecret represents one of the secrets an application can authenticate with
+type ApplicationSecret struct {
+	ID            string     `json:"id"`
+	ApplicationID string     `json:"application_id"`
+	Secret        string     `json:"secret,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+}
+
+// ApplicationUsage represents the number of requests an application made on a single day
+type ApplicationUsage struct {
+	Day          time.Time `json:"day"`
+	RequestCount int64     `json:"request_count"`
 }
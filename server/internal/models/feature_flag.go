@@ -0,0 +1,52 @@
+package models
+
+import (
+	"hash/fnv"
+	"regexp"
+	"time"
+)
+
+// featureNamePattern matches feature names
+var featureNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// ValidFeatureName reports whether name may name a feature
+func ValidFeatureName(name string) bool {
+	return featureNamePattern.MatchString(name)
+}
+
+// FeatureFlag turns a feature on for some applications. An enabled flag is on
+// for the share of applications given by its rollout percentage, so a flag
+// rolled out to 100% is a plain boolean flag.
+type FeatureFlag struct {
+	Name              string `json:"name"`
+	Description       string `json:"description"`
+	Enabled           bool   `json:"enabled"`
+	RolloutPercentage int    `json:"rollout_percentage"`
+	// Overrides turns the flag on or off for applications by ID, regardless
+	// of Enabled and of the rollout
+	Overrides map[string]bool `json:"overrides"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// EnabledFor reports whether the flag is on for an application
+func (f *FeatureFlag) EnabledFor(applicationID string) bool {
+	if enabled, ok := f.Overrides[applicationID]; ok {
+		return enabled
+	}
+	if !f.Enabled {
+		return false
+	}
+	return rolloutBucket(f.Name, applicationID) < f.RolloutPercentage
+}
+
+// rolloutBucket places an application in one of 100 buckets for a flag. The
+// bucket is stable, so raising the rollout percentage only adds applications,
+// and depends on the flag, so that every flag starts with different ones.
+func rolloutBucket(flag, applicationID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(flag))
+	h.Write([]byte{0})
+	h.Write([]byte(applicationID))
+	return int(h.Sum32() % 100)
+}
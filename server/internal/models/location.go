@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+// SavedLocation is a location an application follows
+type SavedLocation struct {
+	ZipCode   string    `json:"zip_code"`
+	CreatedAt time.Time `json:"created_at"`
+}
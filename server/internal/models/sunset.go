@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // SunsetQuality represents the quality of a sunset for photography
 type SunsetQuality struct {
 	ZipCode         string             `json:"zip_code"`
@@ -10,6 +12,7 @@ type SunsetQuality struct {
 	AstronomyData   AstronomyData      `json:"astronomy_data"`
 	LastUpdated     string             `json:"last_updated"`
 	ExpiresAt       string             `json:"expires_at"`
+	Stale           bool               `json:"stale"`
 }
 
 // WeatherData contains meteorological information from weather APIs
@@ -22,6 +25,8 @@ type WeatherData struct {
 	WindSpeed             float64 `json:"wind_speed"`
 	Temperature           float64 `json:"temperature"`
 	Location              string  `json:"location"`
+	// ObservedAt is when the provider last updated the observation
+	ObservedAt            time.Time `json:"observed_at"`
 }
 
 // AstronomyData contains sun/moon position information
@@ -32,4 +37,18 @@ type AstronomyData struct {
 	SunsetTime     string  `json:"sunset_time"`
 	MoonPhase      string  `json:"moon_phase"`
 	MoonIllumination float64 `json:"moon_illumination"`
+	// SunEvents lists the sunrises and sunsets of the forecast days
+	SunEvents        []SunEvent `json:"sun_events,omitempty"`
+}
+
+// Types of sun events
+const (
+	SunEventSunrise = "sunrise"
+	SunEventSunset  = "sunset"
+)
+
+// SunEvent is a sunrise or sunset at a location
+type SunEvent struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
 }
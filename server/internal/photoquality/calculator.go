@@ -1,13 +1,74 @@
 package photoquality
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"math"
 
 	"github.com/kevinmahoney/etrenank/internal/models"
 )
 
-// CalculateSunriseQuality evaluates the photographic quality of a sunrise/sunset
-func CalculateSunriseQuality(weather models.WeatherData, astronomy models.AstronomyData) (float64, map[string]float64, string) {
+// ModelVersion identifies the scoring model. It must be changed whenever the
+// scoring changes so that scores computed by the previous model are not served.
+const ModelVersion = "v1"
+
+// Weights scale the factors of the quality score. A weight of 1 keeps a
+// factor as designed and 0 ignores it.
+type Weights struct {
+	Cloud      float64 `yaml:"cloud" toml:"cloud"`
+	Humidity   float64 `yaml:"humidity" toml:"humidity"`
+	Visibility float64 `yaml:"visibility" toml:"visibility"`
+	AirQuality float64 `yaml:"air_quality" toml:"air_quality"`
+	SunAngle   float64 `yaml:"sun_angle" toml:"sun_angle"`
+	RecentRain float64 `yaml:"recent_rain" toml:"recent_rain"`
+	Wind       float64 `yaml:"wind" toml:"wind"`
+}
+
+// maxWeight caps weights so that a typo cannot let one factor dominate the score
+const maxWeight = 5
+
+// DefaultWeights returns the weights of the scoring model as designed
+func DefaultWeights() Weights {
+	return Weights{Cloud: 1, Humidity: 1, Visibility: 1, AirQuality: 1, SunAngle: 1, RecentRain: 1, Wind: 1}
+}
+
+// Validate checks that every weight is between 0 and maxWeight
+func (w Weights) Validate() error {
+	for name, weight := range w.byName() {
+		if !(weight >= 0 && weight <= maxWeight) {
+			return fmt.Errorf("weight %s must be between 0 and %d", name, maxWeight)
+		}
+	}
+	return nil
+}
+
+// Version identifies the scoring model with these weights, so that scores
+// computed with other weights are not served
+func (w Weights) Version() string {
+	if w == DefaultWeights() {
+		return ModelVersion
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%+v", w)))
+	return ModelVersion + "-" + hex.EncodeToString(sum[:4])
+}
+
+// byName returns the weights by factor name
+func (w Weights) byName() map[string]float64 {
+	return map[string]float64{
+		"cloud":       w.Cloud,
+		"humidity":    w.Humidity,
+		"visibility":  w.Visibility,
+		"air_quality": w.AirQuality,
+		"sun_angle":   w.SunAngle,
+		"recent_rain": w.RecentRain,
+		"wind":        w.Wind,
+	}
+}
+
+// CalculateSunriseQuality evaluates the photographic quality of a sunrise/sunset.
+// Each factor is scaled by its weight.
+func CalculateSunriseQuality(weather models.WeatherData, astronomy models.AstronomyData, weights Weights) (float64, map[string]float64, string) {
 	// Initialize base score
 	qualityScore := 50.0 // Start with neutral score of 50/100
 
@@ -29,6 +90,7 @@ func CalculateSunriseQuality(weather models.WeatherData, astronomy models.Astron
 		// Too many clouds blocks light
 		cloudScore = math.Max(0, 25-(cloudCover-70)*0.8)
 	}
+	cloudScore *= weights.Cloud
 	factors["cloud_score"] = cloudScore
 
 	// === ATMOSPHERIC CLARITY ===
@@ -48,14 +110,17 @@ func CalculateSunriseQuality(weather models.WeatherData, astronomy models.Astron
 	} else { // > 70%
 		humidityScore = math.Max(0, 15-(humidity-70)*0.3) // Too humid = hazy
 	}
+	humidityScore *= weights.Humidity
 	factors["humidity_score"] = humidityScore
 
 	// Visibility factor
 	visibilityScore := math.Min(15, visibility*1.5)
+	visibilityScore *= weights.Visibility
 	factors["visibility_score"] = visibilityScore
 
 	// Air quality factor (lower AQI = better)
 	aqiScore := math.Max(0, 10-(aqi/10))
+	aqiScore *= weights.AirQuality
 	factors["air_quality_score"] = aqiScore
 
 	// === RAYLEIGH SCATTERING POTENTIAL ===
@@ -69,6 +134,7 @@ func CalculateSunriseQuality(weather models.WeatherData, astronomy models.Astron
 	} else {
 		sunAngleScore = math.Max(0, 3-math.Abs(sunAltitude-6)*0.5)
 	}
+	sunAngleScore *= weights.SunAngle
 	factors["sun_angle_score"] = sunAngleScore
 
 	// === WEATHER CONDITIONS ===
@@ -84,6 +150,7 @@ func CalculateSunriseQuality(weather models.WeatherData, astronomy models.Astron
 	} else {
 		rainScore = 0
 	}
+	rainScore *= weights.RecentRain
 	factors["recent_rain_score"] = rainScore
 
 	// Light wind is good (5-15 mph ideal)
@@ -95,6 +162,7 @@ func CalculateSunriseQuality(weather models.WeatherData, astronomy models.Astron
 	} else { // > 15
 		windScore = math.Max(0, 5-(windSpeed-15)*0.3)
 	}
+	windScore *= weights.Wind
 	factors["wind_score"] = windScore
 
 	// === CALCULATE FINAL SCORE ===
@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+)
+
+// redisRetryInterval is how often a fallback store tries to reconnect to Redis
+const redisRetryInterval = 30 * time.Second
+
+// fallbackStore is a Store that serves from a fallback backend while Redis
+// is unreachable and switches to Redis once it can connect, so that a Redis
+// outage at startup does not degrade the API until it is restarted
+type fallbackStore struct {
+	fallback Store
+
+	mu     sync.RWMutex
+	store  Store
+	closed bool
+	// recovered is closed once the store has switched to Redis
+	recovered chan struct{}
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newFallbackStore creates a store serving from fallback and reconnecting
+// to Redis in the background
+func newFallbackStore(fallback Store, redisCfg config.RedisConfig) *fallbackStore {
+	f := &fallbackStore{
+		fallback:  fallback,
+		store:     fallback,
+		recovered: make(chan struct{}),
+		stop:      make(chan struct{}),
+	}
+	go f.reconnect(redisCfg)
+	return f
+}
+
+// reconnect tries to connect to Redis every redisRetryInterval until it
+// succeeds or the store is closed
+func (f *fallbackStore) reconnect(redisCfg config.RedisConfig) {
+	ticker := time.NewTicker(redisRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-f.stop:
+			return
+		}
+
+		redis, err := NewRedisClient(redisCfg)
+		if err != nil {
+			slog.Error("Redis is still unreachable, running on the fallback cache backend", "error", err)
+			continue
+		}
+
+		f.mu.Lock()
+		if f.closed {
+			f.mu.Unlock()
+			redis.Close()
+			return
+		}
+		f.store = redis
+		f.mu.Unlock()
+		close(f.recovered)
+
+		slog.Info("Reconnected to Redis, leaving the fallback cache backend")
+		return
+	}
+}
+
+// current returns the store requests are served from
+func (f *fallbackStore) current() Store {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.store
+}
+
+// Get gets a value from the current store
+func (f *fallbackStore) Get(ctx context.Context, key string) (string, error) {
+	return f.current().Get(ctx, key)
+}
+
+// Set sets a value in the current store
+func (f *fallbackStore) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return f.current().Set(ctx, key, value, ttl)
+}
+
+// SetNX sets a value in the current store if the key does not exist yet
+func (f *fallbackStore) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	return f.current().SetNX(ctx, key, value, ttl)
+}
+
+// Delete deletes a key from the current store
+func (f *fallbackStore) Delete(ctx context.Context, key string) error {
+	return f.current().Delete(ctx, key)
+}
+
+// Incr increments a counter in the current store
+func (f *fallbackStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return f.current().Incr(ctx, key, ttl)
+}
+
+// Decr decrements a counter in the current store
+func (f *fallbackStore) Decr(ctx context.Context, key string) error {
+	return f.current().Decr(ctx, key)
+}
+
+// ZIncrBy increments the score of a member of a sorted set in the current store
+func (f *fallbackStore) ZIncrBy(ctx context.Context, key, member string, increment float64, ttl time.Duration) error {
+	return f.current().ZIncrBy(ctx, key, member, increment, ttl)
+}
+
+// ZRevRange returns up to n members of a sorted set in the current store
+func (f *fallbackStore) ZRevRange(ctx context.Context, key string, n int) ([]string, error) {
+	return f.current().ZRevRange(ctx, key, n)
+}
+
+// TryLock tries to acquire a lock in the current store
+func (f *fallbackStore) TryLock(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	return f.current().TryLock(ctx, key, ttl)
+}
+
+// Publish publishes a message on a channel of the current store
+func (f *fallbackStore) Publish(ctx context.Context, channel, message string) error {
+	return f.current().Publish(ctx, channel, message)
+}
+
+// Subscribe subscribes to a channel of the current store, and subscribes
+// again to Redis once the store switches to it
+func (f *fallbackStore) Subscribe(ctx context.Context, channel string) (<-chan string, func() error) {
+	messages := make(chan string)
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		defer close(messages)
+
+		recovered := f.recovered
+		for {
+			var in <-chan string
+			var unsubscribe func() error
+			if recovered == nil {
+				in, unsubscribe = f.current().Subscribe(ctx, channel)
+			} else {
+				in, unsubscribe = f.fallback.Subscribe(ctx, channel)
+			}
+
+			switched := f.forward(in, messages, recovered, done)
+			unsubscribe()
+			if !switched {
+				return
+			}
+			recovered = nil
+		}
+	}()
+
+	return messages, func() error {
+		once.Do(func() { close(done) })
+		return nil
+	}
+}
+
+// forward forwards the messages of a subscription until the subscription
+// ends, the store switches to Redis or done is closed. It reports whether
+// the store switched.
+func (f *fallbackStore) forward(in <-chan string, out chan<- string, recovered, done <-chan struct{}) bool {
+	for {
+		select {
+		case message, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			select {
+			case out <- message:
+			case <-done:
+				return false
+			}
+		case <-recovered:
+			return true
+		case <-done:
+			return false
+		}
+	}
+}
+
+// Ping checks that the current store is reachable
+func (f *fallbackStore) Ping(ctx context.Context) error {
+	return f.current().Ping(ctx)
+}
+
+// Close stops reconnecting to Redis and closes the fallback and, if the
+// store switched to it, Redis
+func (f *fallbackStore) Close() error {
+	f.stopOnce.Do(func() { close(f.stop) })
+
+	f.mu.Lock()
+	f.closed = true
+	store := f.store
+	f.mu.Unlock()
+
+	err := f.fallback.Close()
+	if store != f.fallback {
+		if closeErr := store.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
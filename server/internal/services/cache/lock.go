@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/kevinmahoney/etrenank/internal/credentials"
+)
+
+// releaseScript deletes a lock only if it is still held with the same token,
+// so that a holder whose lock expired cannot release someone else's lock
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// refreshScript extends the TTL of a lock only if it is still held with the same token
+var refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// redisLock is a distributed lock held in Redis
+type redisLock struct {
+	client *RedisClient
+	key    string
+	token  string
+}
+
+// TryLock tries to acquire a lock that expires after ttl. It returns a nil
+// lock without an error if the lock is already held elsewhere.
+func (r *RedisClient) TryLock(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	ctx, end := r.operation(ctx, "TRYLOCK")
+	defer end()
+
+	token, err := credentials.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	acquired, err := r.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !acquired {
+		return nil, err
+	}
+
+	return &redisLock{client: r, key: key, token: token}, nil
+}
+
+// Release releases the lock if it is still held
+func (l *redisLock) Release(ctx context.Context) error {
+	ctx, end := l.client.operation(ctx, "UNLOCK")
+	defer end()
+
+	return releaseScript.Run(ctx, l.client.client, []string{l.key}, l.token).Err()
+}
+
+// Refresh extends the lock to expire after ttl, reporting false if the lock
+// was lost in the meantime
+func (l *redisLock) Refresh(ctx context.Context, ttl time.Duration) (bool, error) {
+	ctx, end := l.client.operation(ctx, "REFRESHLOCK")
+	defer end()
+
+	refreshed, err := refreshScript.Run(ctx, l.client.client, []string{l.key}, l.token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return refreshed == 1, nil
+}
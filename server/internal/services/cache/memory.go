@@ -0,0 +1,293 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/credentials"
+)
+
+// memorySweepInterval is how often expired keys are removed from a MemoryStore
+const memorySweepInterval = time.Minute
+
+// memoryValue is a string value or a sorted set held by a MemoryStore
+type memoryValue struct {
+	value     string
+	set       map[string]float64
+	expiresAt time.Time
+}
+
+// MemoryStore is a Store held in process memory. It is not shared between
+// instances, so it suits development, tests and single-instance deployments.
+type MemoryStore struct {
+	mu          sync.Mutex
+	values      map[string]*memoryValue
+	subscribers map[string][]chan string
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// NewMemoryStore creates a new in-memory store
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{
+		values:      make(map[string]*memoryValue),
+		subscribers: make(map[string][]chan string),
+		stop:        make(chan struct{}),
+	}
+	go m.sweep()
+	return m
+}
+
+// Ping always succeeds
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close stops removing expired keys
+func (m *MemoryStore) Close() error {
+	m.stopOnce.Do(func() { close(m.stop) })
+	return nil
+}
+
+// Get gets a value
+func (m *MemoryStore) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v := m.lookup(key)
+	if v == nil || v.set != nil {
+		return "", ErrMiss
+	}
+	return v.value, nil
+}
+
+// Set sets a value with a TTL
+func (m *MemoryStore) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.values[key] = &memoryValue{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// SetNX sets a value with a TTL only if the key does not exist yet
+func (m *MemoryStore) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lookup(key) != nil {
+		return false, nil
+	}
+	m.values[key] = &memoryValue{value: value, expiresAt: time.Now().Add(ttl)}
+	return true, nil
+}
+
+// Delete deletes a key
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.values, key)
+	return nil
+}
+
+// Incr increments a counter and sets its TTL, returning the new value
+func (m *MemoryStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	if v := m.lookup(key); v != nil {
+		count, _ = strconv.ParseInt(v.value, 10, 64)
+	}
+	count++
+
+	m.values[key] = &memoryValue{value: strconv.FormatInt(count, 10), expiresAt: time.Now().Add(ttl)}
+	return count, nil
+}
+
+// Decr decrements a counter that exists, keeping its TTL
+func (m *MemoryStore) Decr(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v := m.lookup(key)
+	if v == nil {
+		return nil
+	}
+	count, _ := strconv.ParseInt(v.value, 10, 64)
+	v.value = strconv.FormatInt(count-1, 10)
+	return nil
+}
+
+// ZIncrBy increments the score of a member of a sorted set and sets the set's TTL
+func (m *MemoryStore) ZIncrBy(ctx context.Context, key, member string, increment float64, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v := m.lookup(key)
+	if v == nil || v.set == nil {
+		v = &memoryValue{set: make(map[string]float64)}
+		m.values[key] = v
+	}
+	v.set[member] += increment
+	v.expiresAt = time.Now().Add(ttl)
+	return nil
+}
+
+// ZRevRange returns up to n members of a sorted set, highest score first
+func (m *MemoryStore) ZRevRange(ctx context.Context, key string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v := m.lookup(key)
+	if v == nil || v.set == nil {
+		return nil, nil
+	}
+
+	members := make([]string, 0, len(v.set))
+	for member := range v.set {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if v.set[members[i]] != v.set[members[j]] {
+			return v.set[members[i]] > v.set[members[j]]
+		}
+		return members[i] > members[j]
+	})
+
+	if len(members) > n {
+		members = members[:n]
+	}
+	return members, nil
+}
+
+// TryLock tries to acquire a lock that expires after ttl
+func (m *MemoryStore) TryLock(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	token, err := credentials.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	acquired, _ := m.SetNX(ctx, key, token, ttl)
+	if !acquired {
+		return nil, nil
+	}
+	return &memoryLock{store: m, key: key, token: token}, nil
+}
+
+// Publish delivers a message to the subscribers of a channel. Messages are
+// sent while holding the lock, so that a subscription cannot be closed
+// between looking it up and sending to it; the sends never block.
+func (m *MemoryStore) Publish(ctx context.Context, channel, message string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, subscriber := range m.subscribers[channel] {
+		select {
+		case subscriber <- message:
+		default:
+			// Drop the message rather than block on a slow subscriber, like Redis would
+		}
+	}
+	return nil
+}
+
+// Subscribe subscribes to a channel
+func (m *MemoryStore) Subscribe(ctx context.Context, channel string) (<-chan string, func() error) {
+	messages := make(chan string, 100)
+
+	m.mu.Lock()
+	m.subscribers[channel] = append(m.subscribers[channel], messages)
+	m.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() error {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			subscribers := m.subscribers[channel]
+			for i, subscriber := range subscribers {
+				if subscriber == messages {
+					m.subscribers[channel] = append(subscribers[:i], subscribers[i+1:]...)
+					break
+				}
+			}
+			close(messages)
+		})
+		return nil
+	}
+
+	return messages, unsubscribe
+}
+
+// lookup returns the value of a key unless it has expired; the caller must hold the lock
+func (m *MemoryStore) lookup(key string) *memoryValue {
+	v, ok := m.values[key]
+	if !ok {
+		return nil
+	}
+	if !time.Now().Before(v.expiresAt) {
+		delete(m.values, key)
+		return nil
+	}
+	return v
+}
+
+// sweep periodically removes expired keys that are never read again
+func (m *MemoryStore) sweep() {
+	ticker := time.NewTicker(memorySweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.mu.Lock()
+			for key := range m.values {
+				m.lookup(key)
+			}
+			m.mu.Unlock()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// memoryLock is a lock held in a MemoryStore
+type memoryLock struct {
+	store *MemoryStore
+	key   string
+	token string
+}
+
+// Release releases the lock if it is still held
+func (l *memoryLock) Release(ctx context.Context) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	if v := l.store.lookup(l.key); v != nil && v.value == l.token {
+		delete(l.store.values, l.key)
+	}
+	return nil
+}
+
+// Refresh extends the lock to expire after ttl if it is still held
+func (l *memoryLock) Refresh(ctx context.Context, ttl time.Duration) (bool, error) {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	v := l.store.lookup(l.key)
+	if v == nil || v.value != l.token {
+		return false, nil
+	}
+	v.expiresAt = time.Now().Add(ttl)
+	return true, nil
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestMemoryStorePublishWhileUnsubscribing(t *testing.T) {
+	store := NewMemoryStore()
+	defer store.Close()
+	ctx := context.Background()
+
+	// Publishing must never send on a subscription closed concurrently
+	for i := 0; i < 200; i++ {
+		messages, unsubscribe := store.Subscribe(ctx, "channel")
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				store.Publish(ctx, "channel", "message")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			unsubscribe()
+		}()
+		wg.Wait()
+
+		for range messages {
+		}
+	}
+}
+
+func TestMemoryStorePublish(t *testing.T) {
+	store := NewMemoryStore()
+	defer store.Close()
+	ctx := context.Background()
+
+	messages, unsubscribe := store.Subscribe(ctx, "channel")
+	if err := store.Publish(ctx, "channel", "hello"); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	if got := <-messages; got != "hello" {
+		t.Errorf("got message %q, want %q", got, "hello")
+	}
+
+	unsubscribe()
+	if _, ok := <-messages; ok {
+		t.Error("got a message after unsubscribing, want the channel closed")
+	}
+	if err := store.Publish(ctx, "channel", "ignored"); err != nil {
+		t.Errorf("failed to publish without subscribers: %v", err)
+	}
+}
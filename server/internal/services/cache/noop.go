@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// NoopStore is a Store that stores nothing. Every read misses and every
+// lock is granted, so caching and coordination between instances are
+// disabled. Counters and conditional writes return ErrUnsupported rather
+// than pretending to succeed, so that replay protection fails closed.
+type NoopStore struct{}
+
+// NewNoopStore creates a new no-op store
+func NewNoopStore() *NoopStore {
+	return &NoopStore{}
+}
+
+// Ping always succeeds
+func (NoopStore) Ping(ctx context.Context) error { return nil }
+
+// Close does nothing
+func (NoopStore) Close() error { return nil }
+
+// Get always misses
+func (NoopStore) Get(ctx context.Context, key string) (string, error) { return "", ErrMiss }
+
+// Set discards the value
+func (NoopStore) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return nil
+}
+
+// SetNX returns ErrUnsupported, since the key cannot be known not to exist
+func (NoopStore) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	return false, ErrUnsupported
+}
+
+// Delete does nothing
+func (NoopStore) Delete(ctx context.Context, key string) error { return nil }
+
+// Incr returns ErrUnsupported, since counters cannot be kept
+func (NoopStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return 0, ErrUnsupported
+}
+
+// Decr returns ErrUnsupported, since counters cannot be kept
+func (NoopStore) Decr(ctx context.Context, key string) error {
+	return ErrUnsupported
+}
+
+// ZIncrBy does nothing
+func (NoopStore) ZIncrBy(ctx context.Context, key, member string, increment float64, ttl time.Duration) error {
+	return nil
+}
+
+// ZRevRange always returns an empty set
+func (NoopStore) ZRevRange(ctx context.Context, key string, n int) ([]string, error) {
+	return nil, nil
+}
+
+// TryLock always grants the lock
+func (NoopStore) TryLock(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	return noopLock{}, nil
+}
+
+// Publish discards the message
+func (NoopStore) Publish(ctx context.Context, channel, message string) error { return nil }
+
+// Subscribe returns a channel that never receives messages
+func (NoopStore) Subscribe(ctx context.Context, channel string) (<-chan string, func() error) {
+	messages := make(chan string)
+	var once sync.Once
+	return messages, func() error {
+		once.Do(func() { close(messages) })
+		return nil
+	}
+}
+
+// noopLock is a lock granted by a NoopStore
+type noopLock struct{}
+
+// Release does nothing
+func (noopLock) Release(ctx context.Context) error { return nil }
+
+// Refresh always reports the lock as still held
+func (noopLock) Refresh(ctx context.Context, ttl time.Duration) (bool, error) { return true, nil }
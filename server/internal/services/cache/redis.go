@@ -7,11 +7,14 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// RedisClient represents a Redis client
+// RedisClient is a Store backed by Redis
 type RedisClient struct {
-	client *redis.Client
+	client           *redis.Client
+	operationTimeout time.Duration
 }
 
 // NewRedisClient creates a new Redis client
@@ -30,7 +33,7 @@ func NewRedisClient(cfg config.RedisConfig) (*RedisClient, error) {
 		return nil, err
 	}
 
-	return &RedisClient{client: client}, nil
+	return &RedisClient{client: client, operationTimeout: cfg.OperationTimeout}, nil
 }
 
 // Close closes the Redis client
@@ -38,17 +41,146 @@ func (r *RedisClient) Close() error {
 	return r.client.Close()
 }
 
+// operation starts a span for a Redis command and bounds it by the
+// configured operation timeout, if any. The returned function ends both.
+func (r *RedisClient) operation(ctx context.Context, command string) (context.Context, func()) {
+	ctx, span := tracing.Start(ctx, "redis."+command, attribute.String("db.system", "redis"))
+
+	cancel := context.CancelFunc(func() {})
+	if r.operationTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, r.operationTimeout)
+	}
+
+	return ctx, func() {
+		cancel()
+		span.End()
+	}
+}
+
+// Ping checks that Redis is reachable
+func (r *RedisClient) Ping(ctx context.Context) error {
+	ctx, end := r.operation(ctx, "PING")
+	defer end()
+
+	return r.client.Ping(ctx).Err()
+}
+
 // Get gets a value from Redis
 func (r *RedisClient) Get(ctx context.Context, key string) (string, error) {
-	return r.client.Get(ctx, key).Result()
+	ctx, end := r.operation(ctx, "GET")
+	defer end()
+
+	value, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", ErrMiss
+	}
+	return value, err
 }
 
 // Set sets a value in Redis with a TTL
-func (r *RedisClient) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+func (r *RedisClient) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	ctx, end := r.operation(ctx, "SET")
+	defer end()
+
 	return r.client.Set(ctx, key, value, ttl).Err()
 }
 
 // Delete deletes a key from Redis
 func (r *RedisClient) Delete(ctx context.Context, key string) error {
+	ctx, end := r.operation(ctx, "DEL")
+	defer end()
+
 	return r.client.Del(ctx, key).Err()
 }
+
+// Incr increments a counter in Redis and sets its TTL, returning the new value
+func (r *RedisClient) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	ctx, end := r.operation(ctx, "INCR")
+	defer end()
+
+	var incr *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// decrScript decrements a counter only if it exists, so that a counter that
+// expired is not recreated without a TTL
+var decrScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("DECR", KEYS[1])
+end
+return 0
+`)
+
+// Decr decrements a counter in Redis that exists, keeping its TTL
+func (r *RedisClient) Decr(ctx context.Context, key string) error {
+	ctx, end := r.operation(ctx, "DECR")
+	defer end()
+
+	return decrScript.Run(ctx, r.client, []string{key}).Err()
+}
+
+// SetNX sets a value in Redis with a TTL only if the key does not exist yet,
+// reporting whether the value was set
+func (r *RedisClient) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	ctx, end := r.operation(ctx, "SETNX")
+	defer end()
+
+	return r.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+// Publish publishes a message on a Redis channel
+func (r *RedisClient) Publish(ctx context.Context, channel, message string) error {
+	ctx, end := r.operation(ctx, "PUBLISH")
+	defer end()
+
+	return r.client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe subscribes to a Redis channel. It returns the channel's messages
+// and a function that ends the subscription and closes the message channel.
+func (r *RedisClient) Subscribe(ctx context.Context, channel string) (<-chan string, func() error) {
+	pubsub := r.client.Subscribe(ctx, channel)
+
+	messages := make(chan string)
+	go func() {
+		defer close(messages)
+		for msg := range pubsub.Channel() {
+			messages <- msg.Payload
+		}
+	}()
+
+	return messages, pubsub.Close
+}
+
+// ZIncrBy increments the score of a member of a sorted set in Redis and sets the set's TTL
+func (r *RedisClient) ZIncrBy(ctx context.Context, key, member string, increment float64, ttl time.Duration) error {
+	ctx, end := r.operation(ctx, "ZINCRBY")
+	defer end()
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZIncrBy(ctx, key, increment, member)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	return err
+}
+
+// ZRevRange returns up to n members of a sorted set in Redis, highest score first
+func (r *RedisClient) ZRevRange(ctx context.Context, key string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	ctx, end := r.operation(ctx, "ZREVRANGE")
+	defer end()
+
+	return r.client.ZRevRange(ctx, key, 0, int64(n-1)).Result()
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+)
+
+// Cache backends
+const (
+	BackendRedis  = "redis"
+	BackendMemory = "memory"
+	BackendNone   = "none"
+)
+
+// ErrMiss is returned by Store.Get when a key does not exist
+var ErrMiss = errors.New("cache: key not found")
+
+// ErrUnsupported is returned by stores that cannot perform an operation,
+// such as counting or conditional writes when no backend is configured
+var ErrUnsupported = errors.New("cache: operation not supported by the cache backend")
+
+// Store is a key-value store shared by the instances of the API, used for
+// caching, rate limiting, replay protection, locking and pub/sub
+type Store interface {
+	// Get gets a value, returning ErrMiss if the key does not exist
+	Get(ctx context.Context, key string) (string, error)
+	// Set sets a value with a TTL
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	// SetNX sets a value with a TTL only if the key does not exist yet, reporting whether it was set
+	SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error)
+	// Delete deletes a key
+	Delete(ctx context.Context, key string) error
+	// Incr increments a counter and sets its TTL, returning the new value
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Decr decrements a counter that exists, keeping its TTL
+	Decr(ctx context.Context, key string) error
+	// ZIncrBy increments the score of a member of a sorted set and sets the set's TTL
+	ZIncrBy(ctx context.Context, key, member string, increment float64, ttl time.Duration) error
+	// ZRevRange returns up to n members of a sorted set, highest score first, and none if n is not positive
+	ZRevRange(ctx context.Context, key string, n int) ([]string, error)
+	// TryLock tries to acquire a lock that expires after ttl, returning a
+	// nil lock without an error if it is already held elsewhere
+	TryLock(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+	// Publish publishes a message on a channel
+	Publish(ctx context.Context, channel, message string) error
+	// Subscribe subscribes to a channel, returning its messages and a
+	// function that ends the subscription and closes the message channel
+	Subscribe(ctx context.Context, channel string) (<-chan string, func() error)
+	// Ping checks that the store is reachable
+	Ping(ctx context.Context) error
+	// Close releases the resources of the store
+	Close() error
+}
+
+// Lock is a lock acquired from a Store
+type Lock interface {
+	// Release releases the lock if it is still held
+	Release(ctx context.Context) error
+	// Refresh extends the lock to expire after ttl, reporting false if the
+	// lock was lost in the meantime
+	Refresh(ctx context.Context, ttl time.Duration) (bool, error)
+}
+
+// NewStore creates the store selected by the cache configuration. If Redis
+// is unreachable and a fallback backend is configured, the fallback is used
+// instead so that the API can run in degraded mode, until Redis can be
+// reached again.
+func NewStore(cfg config.CacheConfig, redisCfg config.RedisConfig) (Store, error) {
+	switch cfg.Backend {
+	case BackendRedis:
+		store, err := NewRedisClient(redisCfg)
+		if err == nil {
+			return store, nil
+		}
+		if cfg.Fallback == "" {
+			return nil, err
+		}
+
+		slog.Error("Failed to connect to Redis, falling back until it is reachable", "fallback", cfg.Fallback, "error", err)
+		fallback, err := NewStore(config.CacheConfig{Backend: cfg.Fallback}, redisCfg)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Fallback == BackendRedis {
+			return fallback, nil
+		}
+		return newFallbackStore(fallback, redisCfg), nil
+	case BackendMemory:
+		slog.Warn("Using the in-memory cache backend: rate limits, replay protection and locks are not shared between instances")
+		return NewMemoryStore(), nil
+	case BackendNone:
+		slog.Error("Using no cache backend: rate limits are not enforced and signed requests are rejected")
+		return NewNoopStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// invalidationChannel is the pub/sub channel on which instances announce
+// keys they changed, so that other instances drop their local copies
+const invalidationChannel = "cache:invalidate"
+
+// TierStats holds the hit and miss counts of a cache tier
+type TierStats struct {
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// Stats holds the statistics of a tiered cache
+type Stats struct {
+	Local     TierStats `json:"local"`
+	Shared    TierStats `json:"shared"`
+	LocalSize int       `json:"local_size"`
+}
+
+// TieredCache is a two-tier cache: a bounded in-process LRU holding decoded
+// values in front of a shared Store holding JSON. Writes are announced over
+// the store's pub/sub so that other instances invalidate their local copies.
+type TieredCache[T any] struct {
+	store      Store
+	local      *LRU[T]
+	localTTL   time.Duration
+	instanceID string
+
+	unsubscribe func() error
+
+	localHits    atomic.Uint64
+	localMisses  atomic.Uint64
+	sharedHits   atomic.Uint64
+	sharedMisses atomic.Uint64
+}
+
+// NewTieredCache creates a tiered cache whose local tier holds at most
+// localSize entries for at most localTTL. A localSize of zero disables the
+// local tier.
+func NewTieredCache[T any](store Store, localSize int, localTTL time.Duration) *TieredCache[T] {
+	hostname, _ := os.Hostname()
+
+	c := &TieredCache[T]{
+		store:      store,
+		localTTL:   localTTL,
+		instanceID: fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano()),
+	}
+
+	if localSize > 0 {
+		c.local = NewLRU[T](localSize)
+
+		messages, unsubscribe := store.Subscribe(context.Background(), invalidationChannel)
+		c.unsubscribe = unsubscribe
+		go c.invalidate(messages)
+	}
+
+	return c
+}
+
+// Close stops listening for invalidations
+func (c *TieredCache[T]) Close() error {
+	if c.unsubscribe == nil {
+		return nil
+	}
+	return c.unsubscribe()
+}
+
+// Get returns the value of a key from the local tier, or from the shared
+// store on a local miss. It reports false if the key is in neither tier.
+func (c *TieredCache[T]) Get(ctx context.Context, key string) (T, bool) {
+	var zero T
+
+	ctx, span := tracing.Start(ctx, "cache.get", attribute.String("cache.key", key))
+	result := "miss"
+	defer func() {
+		span.SetAttributes(attribute.String("cache.result", result))
+		span.End()
+	}()
+
+	if c.local != nil {
+		if value, ok := c.local.Get(key); ok {
+			c.localHits.Add(1)
+			result = "local_hit"
+			return value, true
+		}
+		c.localMisses.Add(1)
+	}
+
+	data, err := c.store.Get(ctx, key)
+	if err != nil {
+		c.sharedMisses.Add(1)
+		return zero, false
+	}
+
+	var value T
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		c.sharedMisses.Add(1)
+		return zero, false
+	}
+	c.sharedHits.Add(1)
+	result = "shared_hit"
+
+	if c.local != nil {
+		c.local.Set(key, value, c.localTTL)
+	}
+
+	return value, true
+}
+
+// Set stores the value of a key in both tiers, keeping it in the shared store for ttl
+func (c *TieredCache[T]) Set(ctx context.Context, key string, value T, ttl time.Duration) (err error) {
+	ctx, span := tracing.Start(ctx, "cache.set", attribute.String("cache.key", key))
+	defer func() { tracing.End(span, err) }()
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if err := c.store.Set(ctx, key, string(data), ttl); err != nil {
+		return err
+	}
+
+	if c.local != nil {
+		c.local.Set(key, value, min(ttl, c.localTTL))
+		c.announce(ctx, key)
+	}
+
+	return nil
+}
+
+// Delete removes a key from both tiers
+func (c *TieredCache[T]) Delete(ctx context.Context, key string) error {
+	if c.local != nil {
+		c.local.Delete(key)
+		c.announce(ctx, key)
+	}
+
+	return c.store.Delete(ctx, key)
+}
+
+// Stats returns the hit and miss counts of each tier
+func (c *TieredCache[T]) Stats() Stats {
+	stats := Stats{
+		Local:  tierStats(c.localHits.Load(), c.localMisses.Load()),
+		Shared: tierStats(c.sharedHits.Load(), c.sharedMisses.Load()),
+	}
+	if c.local != nil {
+		stats.LocalSize = c.local.Len()
+	}
+	return stats
+}
+
+// announce tells other instances to drop their local copy of a key
+func (c *TieredCache[T]) announce(ctx context.Context, key string) {
+	if err := c.store.Publish(ctx, invalidationChannel, c.instanceID+" "+key); err != nil {
+		slog.WarnContext(ctx, "Failed to publish cache invalidation", "key", key, "error", err)
+	}
+}
+
+// invalidate drops local copies of keys announced by other instances
+func (c *TieredCache[T]) invalidate(messages <-chan string) {
+	for msg := range messages {
+		instanceID, key, ok := strings.Cut(msg, " ")
+		if !ok || instanceID == c.instanceID {
+			continue
+		}
+		c.local.Delete(key)
+	}
+}
+
+// tierStats computes the hit rate of a tier
+func tierStats(hits, misses uint64) TierStats {
+	stats := TierStats{Hits: hits, Misses: misses}
+	if total := hits + misses; total > 0 {
+		stats.HitRate = float64(hits) / float64(total)
+	}
+	return stats
+}
@@ -0,0 +1,111 @@
+package features
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/models"
+	"github.com/kevinmahoney/etrenank/internal/services/cache"
+	"github.com/kevinmahoney/etrenank/internal/settings"
+)
+
+const (
+	// cacheKey is the cache key of the set of every feature flag, which is
+	// small enough to be cached and evaluated as a whole
+	cacheKey = "feature_flags"
+
+	// cacheTTL bounds how long a change made while the cache store was
+	// unreachable, and could not be invalidated, takes to apply
+	cacheTTL = time.Minute
+
+	// localTTL is how long each instance keeps the flags in memory. Changes
+	// are announced to every instance, so it only bounds missed announcements.
+	localTTL = 10 * time.Second
+)
+
+// Service evaluates feature flags for applications. Flags are stored in the
+// database and cached in memory and in the cache store.
+type Service struct {
+	db       db.FeatureFlagRepository
+	flags    *cache.TieredCache[[]models.FeatureFlag]
+	settings *settings.Manager
+}
+
+// NewService creates a new feature flag service. Features set by the runtime
+// settings are on or off for every application, whatever their flag says, so
+// that a feature can be switched off everywhere at once.
+func NewService(db db.FeatureFlagRepository, store cache.Store, runtimeSettings *settings.Manager) *Service {
+	return &Service{
+		db:       db,
+		flags:    cache.NewTieredCache[[]models.FeatureFlag](store, 1, localTTL),
+		settings: runtimeSettings,
+	}
+}
+
+// Close releases the resources of the service
+func (s *Service) Close() error {
+	return s.flags.Close()
+}
+
+// Enabled reports whether a feature is on for an application. Unknown
+// features, and every feature while the flags cannot be read, are off.
+func (s *Service) Enabled(ctx context.Context, applicationID, name string) bool {
+	if enabled, ok := s.settings.Current().Feature(name); ok {
+		return enabled
+	}
+
+	flags, err := s.Flags(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to read feature flags, treating them as off", "feature", name, "error", err)
+		return false
+	}
+	for i := range flags {
+		if flags[i].Name == name {
+			return flags[i].EnabledFor(applicationID)
+		}
+	}
+	return false
+}
+
+// Flags returns every feature flag, from the cache if possible. The flags
+// are shared and must not be modified.
+func (s *Service) Flags(ctx context.Context) ([]models.FeatureFlag, error) {
+	if flags, ok := s.flags.Get(ctx, cacheKey); ok {
+		return flags, nil
+	}
+
+	flags, err := s.db.ListFeatureFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.flags.Set(ctx, cacheKey, flags, cacheTTL); err != nil {
+		slog.WarnContext(ctx, "Failed to cache feature flags", "error", err)
+	}
+	return flags, nil
+}
+
+// Invalidate drops the cached flags on every instance. It must be called
+// after the flags are changed in the database.
+func (s *Service) Invalidate(ctx context.Context) {
+	if err := s.flags.Delete(ctx, cacheKey); err != nil {
+		slog.WarnContext(ctx, "Failed to invalidate cached feature flags", "error", err)
+	}
+}
+
+// ForApplication returns the feature flags of an application
+func (s *Service) ForApplication(applicationID string) *Flags {
+	return &Flags{service: s, applicationID: applicationID}
+}
+
+// Flags evaluates feature flags for a single application
+type Flags struct {
+	service       *Service
+	applicationID string
+}
+
+// Enabled reports whether a feature is on for the application
+func (f *Flags) Enabled(ctx context.Context, name string) bool {
+	return f.service.Enabled(ctx, f.applicationID, name)
+}
@@ -0,0 +1,180 @@
+package prewarm
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/services/cache"
+	"github.com/kevinmahoney/etrenank/internal/services/sunset"
+)
+
+// leaderKey is the cache lock held by the instance that runs the scheduler
+const leaderKey = "prewarm:leader"
+
+// Scheduler refreshes the scores of popular and saved locations ahead of
+// their sunrise and sunset. Only the instance holding the leader lock in
+// the cache store does the work; the others stand by to take over.
+type Scheduler struct {
+	config        config.PrewarmConfig
+	db            db.LocationRepository
+	store         cache.Store
+	sunsetService *sunset.Service
+
+	leader cache.Lock
+}
+
+// NewScheduler creates a new pre-warming scheduler
+func NewScheduler(cfg config.PrewarmConfig, db db.LocationRepository, store cache.Store, sunsetService *sunset.Service) *Scheduler {
+	return &Scheduler{
+		config:        cfg,
+		db:            db,
+		store:         store,
+		sunsetService: sunsetService,
+	}
+}
+
+// Run runs the scheduler until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if s.elect(ctx) {
+			s.runOnce(ctx)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			s.resign()
+			return
+		}
+	}
+}
+
+// elect acquires or renews the leader lock, reporting whether this instance is the leader
+func (s *Scheduler) elect(ctx context.Context) bool {
+	if s.leader != nil {
+		return s.renew(ctx)
+	}
+
+	leader, err := s.store.TryLock(ctx, leaderKey, s.leaderTTL())
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to acquire pre-warming leadership", "error", err)
+		return false
+	}
+	if leader != nil {
+		slog.InfoContext(ctx, "Acquired pre-warming leadership")
+		s.leader = leader
+	}
+	return leader != nil
+}
+
+// renew extends the leader lock, reporting whether this instance is still the leader
+func (s *Scheduler) renew(ctx context.Context) bool {
+	renewed, err := s.leader.Refresh(ctx, s.leaderTTL())
+	if err == nil && renewed {
+		return true
+	}
+	slog.WarnContext(ctx, "Lost pre-warming leadership", "error", err)
+	s.leader = nil
+	return false
+}
+
+// leaderTTL is how long the leader lock lasts unless renewed. It spans two
+// intervals, so that a leader renewing it during and between rounds keeps
+// it, but expires soon enough for another instance to take over from a
+// dead leader.
+func (s *Scheduler) leaderTTL() time.Duration {
+	return 2 * s.config.Interval
+}
+
+// resign releases the leader lock so that another instance can take over immediately
+func (s *Scheduler) resign() {
+	if s.leader == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.leader.Release(ctx); err != nil {
+		slog.WarnContext(ctx, "Failed to release pre-warming leadership", "error", err)
+	}
+	s.leader = nil
+}
+
+// runOnce refreshes the scores of every candidate location that needs it,
+// pacing refreshes to respect the upstream rate limit. The leader lock is
+// renewed along the way, and the round aborted as soon as it is lost, so
+// that a long round never runs alongside another leader's.
+func (s *Scheduler) runOnce(ctx context.Context) {
+	locations := s.candidates(ctx)
+
+	pace := time.NewTicker(time.Minute / time.Duration(s.config.RequestsPerMinute))
+	defer pace.Stop()
+
+	renewedAt := time.Now()
+	refreshed := 0
+	for _, zipCode := range locations {
+		if time.Since(renewedAt) >= s.config.Interval/2 {
+			if !s.renew(ctx) {
+				slog.WarnContext(ctx, "Aborted pre-warming round", "refreshed", refreshed, "candidates", len(locations))
+				return
+			}
+			renewedAt = time.Now()
+		}
+
+		// Scores that stay fresh until the next round are left to that round
+		ok, err := s.sunsetService.Prewarm(ctx, zipCode, s.config.LeadTime, s.config.Interval)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to pre-warm location", "location", zipCode, "error", err)
+		}
+		if !ok && err == nil {
+			continue
+		}
+		refreshed++
+
+		select {
+		case <-pace.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	if refreshed > 0 {
+		slog.InfoContext(ctx, "Pre-warmed locations", "refreshed", refreshed, "candidates", len(locations))
+	}
+}
+
+// candidates returns the popular and saved locations, without duplicates
+// and most popular first, up to MaxLocations so that a round stays bounded
+func (s *Scheduler) candidates(ctx context.Context) []string {
+	popular, err := s.sunsetService.PopularLocations(ctx, s.config.PopularLocations)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to list popular locations", "error", err)
+	}
+
+	saved, err := s.db.ListSavedZipCodes(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to list saved locations", "error", err)
+	}
+
+	seen := make(map[string]bool)
+	var locations []string
+	for _, zipCode := range append(popular, saved...) {
+		if !seen[zipCode] {
+			seen[zipCode] = true
+			locations = append(locations, zipCode)
+		}
+	}
+
+	if len(locations) > s.config.MaxLocations {
+		slog.WarnContext(ctx, "Too many locations to pre-warm, skipping the rest", "candidates", len(locations), "max", s.config.MaxLocations)
+		locations = locations[:s.config.MaxLocations]
+	}
+	return locations
+}
@@ -0,0 +1,173 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/metrics"
+	"github.com/kevinmahoney/etrenank/internal/services/cache"
+)
+
+// ErrBudgetExhausted is returned instead of calling a provider whose call
+// budget is nearly spent, so that only cached values are served
+var ErrBudgetExhausted = errors.New("upstream call budget exhausted")
+
+// Periods
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// period is a budget period, such as the current UTC day
+type period struct {
+	name   string
+	key    string
+	budget int
+	ttl    time.Duration
+}
+
+// Tracker counts the calls made to an upstream provider in the cache store,
+// so that every instance shares the count, and enforces the daily and
+// monthly call budgets
+type Tracker struct {
+	provider string
+	config   config.QuotaConfig
+	store    cache.Store
+
+	mu sync.Mutex
+	// warned holds the keys of the periods whose budget is past the warning ratio
+	warned map[string]bool
+	// unsupported logs once that the cache store cannot count calls
+	unsupported sync.Once
+}
+
+// NewTracker creates a new call tracker for a provider
+func NewTracker(provider string, cfg config.QuotaConfig, store cache.Store) *Tracker {
+	return &Tracker{
+		provider: provider,
+		config:   cfg,
+		store:    store,
+		warned:   make(map[string]bool),
+	}
+}
+
+// Reserve counts a call about to be made to the provider against every
+// budget. Counters are incremented before they are checked, so that
+// concurrent calls cannot all pass the check and overshoot a budget. If the
+// share of a budget that may be spent before switching to cache-only mode is
+// used up, the call is given back and ErrBudgetExhausted returned. If the
+// counters cannot be updated, the call is allowed.
+//
+// A reserved call that ends up not being made must be given back with
+// Release.
+func (t *Tracker) Reserve(ctx context.Context) (*Reservation, error) {
+	reservation := &Reservation{tracker: t}
+	var counts []int64
+	exhausted := false
+	for _, p := range t.periods(time.Now()) {
+		used, err := t.store.Incr(ctx, p.key, p.ttl)
+		if errors.Is(err, cache.ErrUnsupported) {
+			t.unsupported.Do(func() {
+				slog.WarnContext(ctx, "The cache backend cannot count upstream calls, call budgets are not enforced", "provider", t.provider)
+			})
+			return reservation, nil
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to count upstream call", "provider", t.provider, "period", p.name, "error", err)
+			continue
+		}
+
+		reservation.periods = append(reservation.periods, p)
+		counts = append(counts, used)
+		// The budget was used up if it was before this call was counted
+		if p.budget > 0 && float64(used-1) >= t.config.CacheOnlyRatio*float64(p.budget) {
+			exhausted = true
+		}
+	}
+
+	if exhausted {
+		reservation.Release(ctx)
+		for i, p := range reservation.periods {
+			t.observe(ctx, p, counts[i]-1)
+		}
+		metrics.UpstreamBudgetExhausted.WithLabelValues(t.provider).Set(1)
+		return nil, ErrBudgetExhausted
+	}
+
+	for i, p := range reservation.periods {
+		t.observe(ctx, p, counts[i])
+	}
+	metrics.UpstreamBudgetExhausted.WithLabelValues(t.provider).Set(0)
+	return reservation, nil
+}
+
+// Reservation is a call counted against the budgets of the periods it was
+// reserved in
+type Reservation struct {
+	tracker *Tracker
+	periods []period
+}
+
+// Release gives back a reserved call that was not made, even if ctx is
+// cancelled
+func (r *Reservation) Release(ctx context.Context) {
+	ctx = context.WithoutCancel(ctx)
+	for _, p := range r.periods {
+		if err := r.tracker.store.Decr(ctx, p.key); err != nil {
+			slog.WarnContext(ctx, "Failed to give back upstream call", "provider", r.tracker.provider, "period", p.name, "error", err)
+		}
+	}
+	r.periods = nil
+}
+
+// periods returns the current budget periods. Counters are kept until
+// a day after their period ends, so that late calls are still counted.
+func (t *Tracker) periods(now time.Time) []period {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	return []period{
+		{
+			name:   PeriodDay,
+			key:    "quota:" + t.provider + ":day:" + day.Format("2006-01-02"),
+			budget: t.config.DailyBudget,
+			ttl:    day.AddDate(0, 0, 2).Sub(now),
+		},
+		{
+			name:   PeriodMonth,
+			key:    "quota:" + t.provider + ":month:" + month.Format("2006-01"),
+			budget: t.config.MonthlyBudget,
+			ttl:    month.AddDate(0, 1, 1).Sub(now),
+		},
+	}
+}
+
+// observe exposes the calls made in a period as metrics, and logs a warning
+// once per period when its budget is nearly spent
+func (t *Tracker) observe(ctx context.Context, p period, used int64) {
+	metrics.UpstreamCalls.WithLabelValues(t.provider, p.name).Set(float64(used))
+	if p.budget <= 0 {
+		return
+	}
+	metrics.UpstreamBudget.WithLabelValues(t.provider, p.name).Set(float64(p.budget))
+
+	if float64(used) < t.config.WarnRatio*float64(p.budget) {
+		return
+	}
+
+	t.mu.Lock()
+	warned := t.warned[p.key]
+	t.warned[p.key] = true
+	t.mu.Unlock()
+
+	if !warned {
+		slog.WarnContext(ctx, "Upstream call budget nearly spent",
+			"provider", t.provider, "period", p.name, "used", used, "budget", p.budget,
+			"cache_only_at", int64(t.config.CacheOnlyRatio*float64(p.budget)))
+	}
+}
@@ -0,0 +1,79 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/services/cache"
+)
+
+func TestReserveConcurrently(t *testing.T) {
+	store := cache.NewMemoryStore()
+	defer store.Close()
+	tracker := NewTracker("test", config.QuotaConfig{DailyBudget: 10, WarnRatio: 1, CacheOnlyRatio: 1}, store)
+	ctx := context.Background()
+
+	// Concurrent calls cannot all pass the check and overshoot the budget
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := tracker.Reserve(ctx)
+			if err == nil {
+				allowed.Add(1)
+			} else if !errors.Is(err, ErrBudgetExhausted) {
+				t.Errorf("got error %v, want %v", err, ErrBudgetExhausted)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed := allowed.Load(); allowed != 10 {
+		t.Errorf("got %d calls allowed, want 10", allowed)
+	}
+	if used, err := store.Get(ctx, tracker.periods(time.Now())[0].key); err != nil || used != "10" {
+		t.Errorf("got %q calls counted (%v), want 10", used, err)
+	}
+}
+
+func TestReserveRelease(t *testing.T) {
+	store := cache.NewMemoryStore()
+	defer store.Close()
+	tracker := NewTracker("test", config.QuotaConfig{DailyBudget: 1, WarnRatio: 1, CacheOnlyRatio: 1}, store)
+	ctx := context.Background()
+
+	reservation, err := tracker.Reserve(ctx)
+	if err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	if _, err := tracker.Reserve(ctx); !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("second call: got error %v, want %v", err, ErrBudgetExhausted)
+	}
+
+	// A call that was not made is given back
+	reservation.Release(ctx)
+	if _, err := tracker.Reserve(ctx); err != nil {
+		t.Errorf("call after a release: %v", err)
+	}
+}
+
+func TestReserveUnsupportedStore(t *testing.T) {
+	tracker := NewTracker("test", config.QuotaConfig{DailyBudget: 1, WarnRatio: 1, CacheOnlyRatio: 1}, cache.NewNoopStore())
+	ctx := context.Background()
+
+	// Calls cannot be counted, so budgets are not enforced
+	for i := 0; i < 3; i++ {
+		reservation, err := tracker.Reserve(ctx)
+		if err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+		reservation.Release(ctx)
+	}
+}
@@ -0,0 +1,104 @@
+package sunset
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// popularityTTL keeps a day's request counts around long enough to be
+	// read the following day
+	popularityTTL = 48 * time.Hour
+
+	// popularityFlushInterval is how often request counts are written to
+	// the cache store
+	popularityFlushInterval = 10 * time.Second
+
+	// maxPendingLocations bounds how many locations are counted between
+	// two flushes; requests for other locations are not counted
+	maxPendingLocations = 10000
+)
+
+// popularityKey returns the key of the sorted set counting requests per location on a UTC day
+func popularityKey(day time.Time) string {
+	return fmt.Sprintf("popular_locations:%s", day.UTC().Format("20060102"))
+}
+
+// trackRequest counts a request for a location towards its popularity. It
+// must only be called for locations that were resolved, so that arbitrary
+// strings do not grow the sorted set. Counts are kept in memory and written
+// by flushPopularity, so that requests do not wait on the cache store.
+func (s *Service) trackRequest(zipCode string) {
+	s.popularityMu.Lock()
+	defer s.popularityMu.Unlock()
+
+	if _, ok := s.popularity[zipCode]; !ok && len(s.popularity) >= maxPendingLocations {
+		return
+	}
+	s.popularity[zipCode]++
+}
+
+// Run writes the request counts of locations to the cache store every
+// popularityFlushInterval until ctx is cancelled
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(popularityFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flushPopularity(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// flushPopularity writes the request counts of locations since the last
+// flush to the cache store, with one increment per location
+func (s *Service) flushPopularity(ctx context.Context) {
+	s.popularityMu.Lock()
+	pending := s.popularity
+	s.popularity = make(map[string]float64)
+	s.popularityMu.Unlock()
+
+	key := popularityKey(time.Now())
+	for zipCode, count := range pending {
+		if err := s.store.ZIncrBy(ctx, key, zipCode, count, popularityTTL); err != nil {
+			slog.WarnContext(ctx, "Failed to track location popularity", "locations", len(pending), "error", err)
+			return
+		}
+	}
+}
+
+// PopularLocations returns up to n of the most requested locations of today
+// and, to cover the start of a day, yesterday
+func (s *Service) PopularLocations(ctx context.Context, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	now := time.Now()
+
+	seen := make(map[string]bool)
+	var locations []string
+	for _, day := range []time.Time{now, now.AddDate(0, 0, -1)} {
+		members, err := s.store.ZRevRange(ctx, popularityKey(day), n)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range members {
+			if len(locations) == n {
+				return locations, nil
+			}
+			if !seen[member] {
+				seen[member] = true
+				locations = append(locations, member)
+			}
+		}
+	}
+
+	return locations, nil
+}
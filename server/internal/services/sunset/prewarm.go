@@ -0,0 +1,44 @@
+package sunset
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/services/weather"
+)
+
+// Prewarm refreshes the cached score of a location if a sunrise or sunset
+// happens there within leadTime and the cached score would not stay fresh
+// for another horizon, so that requests around the event are cache hits.
+// Locations without a cached score are refreshed so that their event times
+// become known. The refresh is tracked like those started by requests, so
+// that Drain waits for it. It reports whether this instance refreshed the
+// score.
+func (s *Service) Prewarm(ctx context.Context, zipCode string, leadTime, horizon time.Duration) (bool, error) {
+	zipCode = weather.NormalizeLocation(zipCode)
+	weights := s.settings.Current().Scoring
+	cacheKey := scoreKey(weights, zipCode)
+
+	now := time.Now()
+	if cached, ok := s.getCached(ctx, cacheKey); ok {
+		event, ok := nextEvent(now, cached.Quality.AstronomyData.SunEvents, 0)
+		if !ok || event.Sub(now) > leadTime || cached.SoftExpiresAt.After(now.Add(horizon)) {
+			return false, nil
+		}
+	}
+
+	result := <-s.refreshes.DoChan(cacheKey, func() (interface{}, error) {
+		return s.refreshDetached(ctx, cacheKey, zipCode, weights, false)
+	})
+	if errors.Is(result.Err, errDraining) {
+		return false, nil
+	}
+	if result.Err != nil {
+		return false, result.Err
+	}
+
+	// A nil entry means another instance was already refreshing the score
+	refreshed, _ := result.Val.(*entry)
+	return refreshed != nil, nil
+}
@@ -0,0 +1,471 @@
+package sunset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/metrics"
+	"github.com/kevinmahoney/etrenank/internal/models"
+	"github.com/kevinmahoney/etrenank/internal/photoquality"
+	"github.com/kevinmahoney/etrenank/internal/services/cache"
+	"github.com/kevinmahoney/etrenank/internal/services/weather"
+	"github.com/kevinmahoney/etrenank/internal/settings"
+	"github.com/kevinmahoney/etrenank/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// lockTTL bounds how long an instance may hold the refresh lock of a key,
+	// so that a crashed instance cannot block refreshes
+	lockTTL = 15 * time.Second
+
+	// lockWait is how long to wait for another instance to refresh a key
+	// before fetching it ourselves
+	lockWait = 5 * time.Second
+
+	// lockPollInterval is how often the cache is checked while waiting
+	lockPollInterval = 100 * time.Millisecond
+
+	// refreshTimeout bounds a refresh shared by coalesced requests, which
+	// must not be cancelled when the request that started it goes away
+	refreshTimeout = 20 * time.Second
+)
+
+// CacheStatus describes how a sunset quality was served
+type CacheStatus string
+
+const (
+	// CacheHit means a fresh value was served from the cache
+	CacheHit CacheStatus = "hit"
+	// CacheStale means a stale value was served while it is refreshed in the background
+	CacheStale CacheStatus = "stale"
+	// CacheMiss means the value was computed for this request
+	CacheMiss CacheStatus = "miss"
+)
+
+// Result is a sunset quality along with how it was served
+type Result struct {
+	Quality *models.SunsetQuality
+	Status  CacheStatus
+	// Age is how long ago the value was computed
+	Age time.Duration
+	// TTL is how long the value stays fresh; it is negative for stale values
+	TTL time.Duration
+}
+
+// entry is a cached sunset quality. It is fresh until SoftExpiresAt and is
+// then served stale while it is refreshed, until the cache store evicts it at the hard expiry.
+type entry struct {
+	Quality       models.SunsetQuality `json:"quality"`
+	StoredAt      time.Time            `json:"stored_at"`
+	SoftExpiresAt time.Time            `json:"soft_expires_at"`
+}
+
+// Service computes sunset quality scores, caching them in memory and in the cache store
+type Service struct {
+	store         cache.Store
+	entries       *cache.TieredCache[entry]
+	weatherClient *weather.Client
+	settings      *settings.Manager
+	config        config.CacheConfig
+
+	// refreshes coalesces concurrent refreshes of the same key in this process
+	refreshes singleflight.Group
+
+	// Refreshes run detached from the requests that start them, so they are
+	// tracked to be waited for on shutdown, and cancelled with background
+	// if they overrun it
+	mu             sync.Mutex
+	draining       bool
+	inflight       sync.WaitGroup
+	background     context.Context
+	stopBackground context.CancelFunc
+
+	// popularity counts the requests per location since the last flush
+	popularityMu sync.Mutex
+	popularity   map[string]float64
+}
+
+// errDraining is returned by refreshes started once the service is draining
+var errDraining = errors.New("sunset quality service is shutting down")
+
+// NewService creates a new sunset quality service. Scores are computed with
+// the scoring weights of the current runtime settings.
+func NewService(cfg config.CacheConfig, store cache.Store, weatherClient *weather.Client, runtimeSettings *settings.Manager) *Service {
+	background, stopBackground := context.WithCancel(context.Background())
+	return &Service{
+		store:          store,
+		entries:        cache.NewTieredCache[entry](store, cfg.LocalSize, cfg.LocalTTL),
+		weatherClient:  weatherClient,
+		settings:       runtimeSettings,
+		config:         cfg,
+		background:     background,
+		stopBackground: stopBackground,
+		popularity:     make(map[string]float64),
+	}
+}
+
+// Drain stops starting refreshes and waits for those in flight, including
+// their upstream calls, to complete. Refreshes still running when ctx
+// expires are cancelled.
+func (s *Service) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.stopBackground()
+		return fmt.Errorf("cancelled in-flight refreshes: %v", ctx.Err())
+	}
+}
+
+// Close writes the remaining request counts of locations, giving up when
+// ctx is done, and releases the resources of the service
+func (s *Service) Close(ctx context.Context) error {
+	s.flushPopularity(ctx)
+	return s.entries.Close()
+}
+
+// CacheStats returns the hit and miss counts of each cache tier
+func (s *Service) CacheStats() cache.Stats {
+	return s.entries.Stats()
+}
+
+// GetSunsetQuality returns the sunset quality for a zip code. Fresh cached
+// values are served as is. Stale values are served immediately while they
+// are refreshed in the background, so that the last good value keeps being
+// served while the weather provider is down. On a cache miss only one
+// request per key computes the value: concurrent requests in this process
+// share its result, and other instances wait for it through a cache lock.
+func (s *Service) GetSunsetQuality(ctx context.Context, zipCode string) (*Result, error) {
+	ctx, span := tracing.Start(ctx, "sunset.get_quality", attribute.String("location", zipCode))
+
+	result, err := s.getSunsetQuality(ctx, zipCode)
+	if err == nil {
+		span.SetAttributes(attribute.String("cache.status", string(result.Status)))
+		s.trackRequest(result.Quality.ZipCode)
+	}
+	tracing.End(span, err)
+
+	return result, err
+}
+
+// getSunsetQuality implements GetSunsetQuality
+func (s *Service) getSunsetQuality(ctx context.Context, zipCode string) (*Result, error) {
+	zipCode = weather.NormalizeLocation(zipCode)
+	weights := s.settings.Current().Scoring
+	cacheKey := scoreKey(weights, zipCode)
+
+	if cached, ok := s.getCached(ctx, cacheKey); ok {
+		now := time.Now()
+		result := &Result{
+			Quality: &cached.Quality,
+			Status:  CacheHit,
+			Age:     now.Sub(cached.StoredAt),
+			TTL:     cached.SoftExpiresAt.Sub(now),
+		}
+
+		if result.TTL <= 0 {
+			result.Status = CacheStale
+			result.Quality.Stale = true
+			s.refreshInBackground(ctx, cacheKey, zipCode, weights)
+		}
+
+		return result, nil
+	}
+
+	result := s.refreshes.DoChan(cacheKey, func() (interface{}, error) {
+		return s.refreshDetached(ctx, cacheKey, zipCode, weights, true)
+	})
+
+	var cached *entry
+	select {
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		cached, _ = res.Val.(*entry)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if cached == nil {
+		// The request joined a background refresh that skipped its work
+		// because another instance is refreshing the key. Refreshing with
+		// wait waits for that instance, or computes the value if it takes
+		// too long, so it always returns a value or an error.
+		var err error
+		cached, err = s.refresh(ctx, cacheKey, zipCode, weights, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Result{
+		Quality: &cached.Quality,
+		Status:  CacheMiss,
+		Age:     time.Since(cached.StoredAt),
+		TTL:     time.Until(cached.SoftExpiresAt),
+	}, nil
+}
+
+// scoreKey returns the cache key of the score of a normalized location under
+// the scoring model with the given weights
+func scoreKey(weights photoquality.Weights, zipCode string) string {
+	return fmt.Sprintf("sunset_quality:%s:%s", weights.Version(), zipCode)
+}
+
+// refreshInBackground refreshes a stale key without blocking the request
+func (s *Service) refreshInBackground(ctx context.Context, cacheKey, zipCode string, weights photoquality.Weights) {
+	s.refreshes.DoChan(cacheKey, func() (interface{}, error) {
+		cached, err := s.refreshDetached(ctx, cacheKey, zipCode, weights, false)
+		if err != nil && !errors.Is(err, errDraining) {
+			slog.WarnContext(ctx, "Failed to refresh stale value, serving the last good value", "key", cacheKey, "error", err)
+		}
+		return cached, err
+	})
+}
+
+// refreshDetached refreshes a key detached from the request that started
+// it, which must not cancel a refresh shared by coalesced requests. The
+// refresh is tracked until it completes so that Drain can wait for it.
+func (s *Service) refreshDetached(ctx context.Context, cacheKey, zipCode string, weights photoquality.Weights, wait bool) (*entry, error) {
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return nil, errDraining
+	}
+	s.inflight.Add(1)
+	s.mu.Unlock()
+	defer s.inflight.Done()
+
+	refreshCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+	defer cancel()
+	stop := context.AfterFunc(s.background, cancel)
+	defer stop()
+
+	return s.refresh(refreshCtx, cacheKey, zipCode, weights, wait)
+}
+
+// refresh computes and caches the sunset quality of a key, unless another
+// instance holding the refresh lock does so first. If wait is false and
+// another instance is refreshing the key, refresh returns a nil entry
+// without waiting.
+func (s *Service) refresh(ctx context.Context, cacheKey, zipCode string, weights photoquality.Weights, wait bool) (*entry, error) {
+	lock, err := s.store.TryLock(ctx, "lock:"+cacheKey, lockTTL)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to acquire refresh lock", "key", cacheKey, "error", err)
+	}
+
+	if lock != nil {
+		defer lock.Release(context.WithoutCancel(ctx))
+
+		// Another instance may have refreshed the key just before we got the lock
+		if cached, ok := s.getFresh(ctx, cacheKey); ok {
+			return cached, nil
+		}
+	} else if err == nil {
+		if !wait {
+			return nil, nil
+		}
+
+		// Another instance is refreshing the key; wait for its result
+		if cached, ok := s.waitForRefresh(ctx, cacheKey); ok {
+			return cached, nil
+		}
+	}
+
+	sunsetQuality, validUntil, err := s.compute(ctx, zipCode, weights)
+	if err != nil {
+		return nil, err
+	}
+
+	// A score is fresh for as long as the forecast it was computed from, so
+	// rescoring a cached forecast does not extend its life
+	now := time.Now()
+	cached := &entry{
+		Quality:       *sunsetQuality,
+		StoredAt:      now,
+		SoftExpiresAt: latest(validUntil, now.Add(minFreshTTL)),
+	}
+	cached.Quality.ExpiresAt = cached.SoftExpiresAt.Format(time.RFC3339)
+
+	// Cache the result until the hard expiry
+	if err := s.entries.Set(ctx, cacheKey, *cached, cached.SoftExpiresAt.Sub(now)+s.config.StaleTTL); err != nil {
+		slog.WarnContext(ctx, "Failed to cache value", "key", cacheKey, "error", err)
+	}
+
+	return cached, nil
+}
+
+// waitForRefresh polls the cache until another instance has stored a fresh
+// value for the key or lockWait has passed
+func (s *Service) waitForRefresh(ctx context.Context, cacheKey string) (*entry, bool) {
+	deadline := time.NewTimer(lockWait)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if cached, ok := s.getFresh(ctx, cacheKey); ok {
+				return cached, true
+			}
+		case <-deadline.C:
+			return nil, false
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// getFresh reads a cache entry, ignoring it if it is stale
+func (s *Service) getFresh(ctx context.Context, cacheKey string) (*entry, bool) {
+	cached, ok := s.getCached(ctx, cacheKey)
+	if !ok || !time.Now().Before(cached.SoftExpiresAt) {
+		return nil, false
+	}
+	return cached, true
+}
+
+// getCached reads a cache entry, fresh or stale. The entry is a copy that
+// the caller may modify.
+func (s *Service) getCached(ctx context.Context, cacheKey string) (*entry, bool) {
+	cached, ok := s.entries.Get(ctx, cacheKey)
+
+	// Values cached in an older format lack the entry metadata and are ignored
+	if !ok || cached.StoredAt.IsZero() {
+		return nil, false
+	}
+
+	return &cached, true
+}
+
+// compute calculates the sunset quality from the weather forecast, and
+// returns until when the forecast, and thus the score, is valid
+func (s *Service) compute(ctx context.Context, zipCode string, weights photoquality.Weights) (quality *models.SunsetQuality, validUntil time.Time, err error) {
+	ctx, span := tracing.Start(ctx, "sunset.compute", attribute.String("location", zipCode))
+	defer func() { tracing.End(span, err) }()
+
+	raw, fetchedAt, cached, err := s.getForecast(ctx, zipCode)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	weatherData, astronomyData, err := weather.ParseForecast(raw)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	validUntil = freshUntil(fetchedAt, *weatherData, *astronomyData, s.config)
+	if !cached {
+		s.cacheForecast(ctx, zipCode, raw, fetchedAt, validUntil)
+	}
+
+	// Calculate sunset quality
+	modelVersion := weights.Version()
+	_, scoreSpan := tracing.Start(ctx, "sunset.score", attribute.String("model_version", modelVersion))
+	overallQuality, factors, interpretation := photoquality.CalculateSunriseQuality(*weatherData, *astronomyData, weights)
+	scoreSpan.SetAttributes(attribute.Float64("score", overallQuality))
+	scoreSpan.End()
+	metrics.SunsetQualityScore.WithLabelValues(modelVersion).Observe(overallQuality)
+
+	return &models.SunsetQuality{
+		ZipCode:        zipCode,
+		OverallQuality: overallQuality,
+		Factors:        factors,
+		Interpretation: interpretation,
+		WeatherData:    *weatherData,
+		AstronomyData:  *astronomyData,
+		LastUpdated:    time.Now().Format(time.RFC3339),
+	}, validUntil, nil
+}
+
+// getForecast returns the raw provider forecast of a location and when it
+// was fetched, fetching it only if no valid forecast is cached. Caching the
+// raw forecast separately from scores means that scores can be recomputed
+// after a scoring model change without calling the provider again. cached
+// reports whether the forecast was served from the cache.
+func (s *Service) getForecast(ctx context.Context, zipCode string) (forecast []byte, fetchedAt time.Time, cached bool, err error) {
+	ctx, span := tracing.Start(ctx, "sunset.get_forecast", attribute.String("provider", weather.Provider))
+	defer func() { tracing.End(span, err) }()
+
+	if raw, fetchedAt, ok := s.getCachedForecast(ctx, zipCode); ok {
+		span.SetAttributes(attribute.Bool("forecast.cached", true))
+		return raw, fetchedAt, true, nil
+	}
+	span.SetAttributes(attribute.Bool("forecast.cached", false))
+
+	fetchedAt = time.Now()
+	raw, err := s.weatherClient.FetchForecast(ctx, zipCode)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	return raw, fetchedAt, false, nil
+}
+
+// getCachedForecast reads the latest forecast cached for a location and
+// when it was fetched
+func (s *Service) getCachedForecast(ctx context.Context, zipCode string) ([]byte, time.Time, bool) {
+	issued, err := s.store.Get(ctx, latestForecastKey(zipCode))
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	fetchedAt, err := time.Parse(time.RFC3339Nano, issued)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+
+	raw, err := s.store.Get(ctx, forecastKey(zipCode, fetchedAt))
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	return []byte(raw), fetchedAt, true
+}
+
+// cacheForecast caches the raw provider forecast of a location for as long
+// as it is valid, that is until the provider is expected to publish a newer
+// one, and makes it the latest forecast of the location
+func (s *Service) cacheForecast(ctx context.Context, zipCode string, raw []byte, fetchedAt, validUntil time.Time) {
+	ttl := time.Until(validUntil)
+	if ttl <= 0 {
+		return
+	}
+
+	cacheKey := forecastKey(zipCode, fetchedAt)
+	if err := s.store.Set(ctx, cacheKey, string(raw), ttl); err != nil {
+		slog.WarnContext(ctx, "Failed to cache forecast", "key", cacheKey, "error", err)
+		return
+	}
+	if err := s.store.Set(ctx, latestForecastKey(zipCode), fetchedAt.UTC().Format(time.RFC3339Nano), ttl); err != nil {
+		slog.WarnContext(ctx, "Failed to cache forecast", "key", latestForecastKey(zipCode), "error", err)
+	}
+}
+
+// forecastKey returns the cache key of the raw provider forecast of a
+// location fetched at fetchedAt, keyed by the hour of the forecast issue
+func forecastKey(zipCode string, fetchedAt time.Time) string {
+	return fmt.Sprintf("weather:raw:%s:%s:%s", weather.Provider, zipCode, fetchedAt.UTC().Format("2006010215"))
+}
+
+// latestForecastKey returns the cache key holding when the latest forecast
+// of a location was fetched, which is looked up in any later hour
+func latestForecastKey(zipCode string) string {
+	return fmt.Sprintf("weather:raw:%s:%s:latest", weather.Provider, zipCode)
+}
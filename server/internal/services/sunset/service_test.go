@@ -0,0 +1,277 @@
+package sunset
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/services/cache"
+	"github.com/kevinmahoney/etrenank/internal/services/quota"
+	"github.com/kevinmahoney/etrenank/internal/services/weather"
+	"github.com/kevinmahoney/etrenank/internal/settings"
+)
+
+// testForecast is a forecast of the weather provider without sun events,
+// so that scores computed from it stay fresh for the fresh TTL
+const testForecast = `{
+	"location": {"name": "New York", "region": "New York", "tz_id": "America/New_York"},
+	"current": {"temp_c": 18, "is_day": 1, "wind_mph": 5, "humidity": 55, "cloud": 40, "vis_km": 16}
+}`
+
+// testService is a sunset quality service calling a fake weather provider
+type testService struct {
+	*Service
+	store cache.Store
+	// settingsFile is the runtime settings file of the service
+	settingsFile string
+	// calls counts the calls made to the weather provider
+	calls atomic.Int32
+	// fail makes the weather provider fail
+	fail atomic.Bool
+}
+
+// newTestService creates a sunset quality service backed by an in-memory
+// cache store and a fake weather provider
+func newTestService(t *testing.T) *testService {
+	t.Helper()
+
+	ts := &testService{
+		store:        cache.NewMemoryStore(),
+		settingsFile: filepath.Join(t.TempDir(), "settings.yaml"),
+	}
+	t.Cleanup(func() { ts.store.Close() })
+
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts.calls.Add(1)
+		if ts.fail.Load() {
+			http.Error(w, "unavailable", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testForecast))
+	}))
+	t.Cleanup(provider.Close)
+
+	weatherClient := weather.NewClient(config.WeatherConfig{
+		APIKey:              "test",
+		BaseURL:             provider.URL,
+		Timeout:             5 * time.Second,
+		RetryBaseDelay:      time.Millisecond,
+		RetryMaxDelay:       time.Millisecond,
+		BreakerFailures:     5,
+		BreakerOpenDuration: time.Minute,
+	}, quota.NewTracker(weather.Provider, config.QuotaConfig{WarnRatio: 0.8, CacheOnlyRatio: 0.95}, ts.store))
+
+	if err := os.WriteFile(ts.settingsFile, nil, 0o600); err != nil {
+		t.Fatalf("failed to write runtime settings: %v", err)
+	}
+	runtimeSettings, err := settings.NewManager(config.RuntimeConfig{File: ts.settingsFile}, db.NewMemoryDB())
+	if err != nil {
+		t.Fatalf("failed to create runtime settings: %v", err)
+	}
+
+	ts.Service = NewService(config.CacheConfig{
+		FreshTTL:                  time.Hour,
+		ObservationUpdateInterval: 15 * time.Minute,
+		ForecastUpdateInterval:    time.Hour,
+		EventLeadTime:             time.Hour,
+		EventGrace:                15 * time.Minute,
+		StaleTTL:                  time.Hour,
+	}, ts.store, weatherClient, runtimeSettings)
+	t.Cleanup(func() {
+		ts.Drain(context.Background())
+		ts.Close(context.Background())
+	})
+	return ts
+}
+
+// waitFor waits for a background refresh to make cond true
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expire makes the cached score of a location stale, and drops its raw
+// forecast so that refreshing it calls the provider again
+func (ts *testService) expire(t *testing.T, zipCode string) {
+	t.Helper()
+	ctx := context.Background()
+
+	cacheKey := scoreKey(ts.settings.Current().Scoring, zipCode)
+	cached, ok := ts.getCached(ctx, cacheKey)
+	if !ok {
+		t.Fatalf("no cached score for %s", zipCode)
+	}
+	cached.SoftExpiresAt = time.Now().Add(-time.Minute)
+	if err := ts.entries.Set(ctx, cacheKey, *cached, time.Hour); err != nil {
+		t.Fatalf("failed to expire cached score: %v", err)
+	}
+	if err := ts.store.Delete(ctx, latestForecastKey(zipCode)); err != nil {
+		t.Fatalf("failed to drop cached forecast: %v", err)
+	}
+}
+
+// setSettings replaces the runtime settings of the service
+func (ts *testService) setSettings(t *testing.T, document string) {
+	t.Helper()
+
+	if err := os.WriteFile(ts.settingsFile, []byte(document), 0o600); err != nil {
+		t.Fatalf("failed to write runtime settings: %v", err)
+	}
+	if err := ts.settings.Reload(context.Background(), "test"); err != nil {
+		t.Fatalf("failed to reload runtime settings: %v", err)
+	}
+}
+
+func TestGetSunsetQualityCacheMissThenHit(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+
+	result, err := ts.GetSunsetQuality(ctx, "10001")
+	if err != nil {
+		t.Fatalf("first request failed: %v", err)
+	}
+	if result.Status != CacheMiss {
+		t.Errorf("first request: got status %q, want %q", result.Status, CacheMiss)
+	}
+	if result.Quality.WeatherData.Location != "New York, New York" {
+		t.Errorf("got location %q, want %q", result.Quality.WeatherData.Location, "New York, New York")
+	}
+
+	// Locations are normalized, so a differently written location is a hit too
+	result, err = ts.GetSunsetQuality(ctx, " 10001-1234 ")
+	if err != nil {
+		t.Fatalf("second request failed: %v", err)
+	}
+	if result.Status != CacheHit {
+		t.Errorf("second request: got status %q, want %q", result.Status, CacheHit)
+	}
+	if result.TTL <= 0 {
+		t.Errorf("got TTL %s for a hit, want a positive TTL", result.TTL)
+	}
+
+	if calls := ts.calls.Load(); calls != 1 {
+		t.Errorf("got %d calls to the provider, want 1", calls)
+	}
+}
+
+func TestGetSunsetQualityStale(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := ts.GetSunsetQuality(ctx, "10001"); err != nil {
+		t.Fatalf("first request failed: %v", err)
+	}
+	ts.expire(t, "10001")
+
+	// The stale score is served at once while it is refreshed in the background
+	result, err := ts.GetSunsetQuality(ctx, "10001")
+	if err != nil {
+		t.Fatalf("stale request failed: %v", err)
+	}
+	if result.Status != CacheStale || !result.Quality.Stale {
+		t.Errorf("got status %q and stale %t, want %q and true", result.Status, result.Quality.Stale, CacheStale)
+	}
+	if result.TTL > 0 {
+		t.Errorf("got TTL %s for a stale value, want a negative TTL", result.TTL)
+	}
+
+	cacheKey := scoreKey(ts.settings.Current().Scoring, "10001")
+	waitFor(t, "the background refresh", func() bool {
+		_, ok := ts.getFresh(ctx, cacheKey)
+		return ok
+	})
+	if calls := ts.calls.Load(); calls != 2 {
+		t.Errorf("got %d calls to the provider, want 2", calls)
+	}
+
+	result, err = ts.GetSunsetQuality(ctx, "10001")
+	if err != nil {
+		t.Fatalf("request after the refresh failed: %v", err)
+	}
+	if result.Status != CacheHit || result.Quality.Stale {
+		t.Errorf("after the refresh: got status %q and stale %t, want %q and false", result.Status, result.Quality.Stale, CacheHit)
+	}
+}
+
+func TestGetSunsetQualityStaleWhileProviderDown(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := ts.GetSunsetQuality(ctx, "10001"); err != nil {
+		t.Fatalf("first request failed: %v", err)
+	}
+	ts.expire(t, "10001")
+	ts.fail.Store(true)
+
+	// The last good score keeps being served while refreshing it fails
+	for i := 1; i <= 2; i++ {
+		result, err := ts.GetSunsetQuality(ctx, "10001")
+		if err != nil {
+			t.Fatalf("stale request %d failed: %v", i, err)
+		}
+		if result.Status != CacheStale {
+			t.Errorf("stale request %d: got status %q, want %q", i, result.Status, CacheStale)
+		}
+		waitFor(t, "the background refresh to fail", func() bool {
+			return ts.calls.Load() > int32(i)
+		})
+	}
+}
+
+func TestGetSunsetQualityMissWhileProviderDown(t *testing.T) {
+	ts := newTestService(t)
+	ts.fail.Store(true)
+
+	if _, err := ts.GetSunsetQuality(context.Background(), "10001"); err == nil {
+		t.Error("got no error for a miss while the provider is down")
+	}
+}
+
+func TestGetSunsetQualityRescoresCachedForecast(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+
+	before, err := ts.GetSunsetQuality(ctx, "10001")
+	if err != nil {
+		t.Fatalf("first request failed: %v", err)
+	}
+	version := ts.settings.Current().Scoring.Version()
+	calls := ts.calls.Load()
+
+	// A new scoring model misses the cached scores but not the cached forecast
+	ts.setSettings(t, "scoring:\n  cloud: 2\n")
+	if ts.settings.Current().Scoring.Version() == version {
+		t.Fatal("changing the weights did not change the scoring model version")
+	}
+
+	after, err := ts.GetSunsetQuality(ctx, "10001")
+	if err != nil {
+		t.Fatalf("request after the model change failed: %v", err)
+	}
+	if after.Status != CacheMiss {
+		t.Errorf("after the model change: got status %q, want %q", after.Status, CacheMiss)
+	}
+	if rescoring := ts.calls.Load() - calls; rescoring != 0 {
+		t.Errorf("rescoring made %d calls to the provider, want 0", rescoring)
+	}
+
+	// The new score is only fresh for as long as the forecast it was computed from
+	if after.Quality.ExpiresAt != before.Quality.ExpiresAt {
+		t.Errorf("rescored score expires at %s, want %s like the forecast", after.Quality.ExpiresAt, before.Quality.ExpiresAt)
+	}
+}
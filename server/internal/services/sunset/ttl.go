@@ -0,0 +1,84 @@
+package sunset
+
+import (
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/models"
+)
+
+// minFreshTTL keeps scores fresh for at least this long, so that a provider
+// lagging behind its update cycle is not polled continuously
+const minFreshTTL = time.Minute
+
+// freshUntil computes when a score computed at now should be refreshed,
+// based on when the provider updates its data and when the next sunrise or
+// sunset happens at the location.
+//
+// Until shortly before an event (EventLeadTime), conditions at the event are
+// not expected to change much, so the score lives until the next forecast
+// update or until the lead window opens. Within the lead window the score
+// follows each observation update, and it never outlives the event by more
+// than EventGrace. Without known events the configured FreshTTL is used.
+func freshUntil(now time.Time, weatherData models.WeatherData, astronomyData models.AstronomyData, cfg config.CacheConfig) time.Time {
+	event, ok := nextEvent(now, astronomyData.SunEvents, cfg.EventGrace)
+	if !ok {
+		return now.Add(cfg.FreshTTL)
+	}
+
+	var expiry time.Time
+	if windowStart := event.Add(-cfg.EventLeadTime); now.Before(windowStart) {
+		expiry = earliest(windowStart, now.Add(cfg.ForecastUpdateInterval))
+	} else {
+		expiry = earliest(nextObservationUpdate(now, weatherData.ObservedAt, cfg.ObservationUpdateInterval), event.Add(cfg.EventGrace))
+	}
+
+	if minExpiry := now.Add(minFreshTTL); expiry.Before(minExpiry) {
+		return minExpiry
+	}
+	return expiry
+}
+
+// nextEvent returns the earliest sun event that has not been over for more than grace
+func nextEvent(now time.Time, events []models.SunEvent, grace time.Duration) (time.Time, bool) {
+	var next time.Time
+	for _, event := range events {
+		if event.Time.Add(grace).After(now) && (next.IsZero() || event.Time.Before(next)) {
+			next = event.Time
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// nextObservationUpdate returns when the provider is expected to publish the
+// observation following the one made at observedAt
+func nextObservationUpdate(now, observedAt time.Time, interval time.Duration) time.Time {
+	if observedAt.IsZero() || interval <= 0 {
+		return now.Add(interval)
+	}
+
+	next := observedAt.Add(interval)
+	if next.After(now) {
+		return next
+	}
+
+	// The provider is late; expect the update at the next multiple of the interval
+	missed := now.Sub(next)/interval + 1
+	return next.Add(missed * interval)
+}
+
+// earliest returns the earlier of two times
+func earliest(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// latest returns the later of two times
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,135 @@
+package usage
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/db"
+)
+
+// key identifies the request count of an application on a single UTC day
+type key struct {
+	applicationID string
+	day           time.Time
+}
+
+// count is a buffered request count
+type count struct {
+	requests   int64
+	lastUsedAt time.Time
+}
+
+// Recorder counts the requests of applications in memory and writes the
+// counts to the database in batches, so that authenticating a request does
+// not wait on a database write, and requests of the same application do not
+// contend for its rows
+type Recorder struct {
+	db       db.ApplicationRepository
+	interval time.Duration
+
+	mu     sync.Mutex
+	counts map[key]*count
+	// flushMu serializes flushes, so that the final flush on shutdown
+	// waits for a periodic flush in progress
+	flushMu sync.Mutex
+}
+
+// NewRecorder creates a new usage recorder flushing every interval
+func NewRecorder(db db.ApplicationRepository, interval time.Duration) *Recorder {
+	return &Recorder{
+		db:       db,
+		interval: interval,
+		counts:   make(map[key]*count),
+	}
+}
+
+// Record counts a request of an application
+func (r *Recorder) Record(applicationID string) {
+	now := time.Now()
+	k := key{applicationID: applicationID, day: truncateDay(now)}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.counts[k]
+	if !ok {
+		c = &count{}
+		r.counts[k] = c
+	}
+	c.requests++
+	c.lastUsedAt = now
+}
+
+// Run flushes the counts every interval until ctx is cancelled
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.Flush(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Flush writes the buffered counts to the database. If the write fails, the
+// counts are kept to be written by the next flush.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	r.mu.Lock()
+	pending := r.counts
+	r.counts = make(map[key]*count)
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	counts := make([]db.UsageCount, 0, len(pending))
+	for k, c := range pending {
+		counts = append(counts, db.UsageCount{
+			ApplicationID: k.applicationID,
+			Day:           k.day,
+			Requests:      c.requests,
+			LastUsedAt:    c.lastUsedAt,
+		})
+	}
+
+	if err := r.db.RecordApplicationUsage(ctx, counts); err != nil {
+		slog.WarnContext(ctx, "Failed to record application usage, retrying on the next flush", "applications", len(pending), "error", err)
+		r.restore(pending)
+		return err
+	}
+	return nil
+}
+
+// restore puts back counts that could not be written
+func (r *Recorder) restore(pending map[key]*count) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, c := range pending {
+		current, ok := r.counts[k]
+		if !ok {
+			r.counts[k] = c
+			continue
+		}
+		current.requests += c.requests
+		if c.lastUsedAt.After(current.lastUsedAt) {
+			current.lastUsedAt = c.lastUsedAt
+		}
+	}
+}
+
+// truncateDay returns the start of the UTC day of t
+func truncateDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
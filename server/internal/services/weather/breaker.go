@@ -0,0 +1,124 @@
+package weather
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/metrics"
+)
+
+// ErrCircuitOpen is returned without calling the weather provider while it
+// is considered unhealthy
+var ErrCircuitOpen = errors.New("weather API circuit breaker is open")
+
+// Circuit breaker states
+const (
+	StateClosed   = "closed"
+	StateHalfOpen = "half-open"
+	StateOpen     = "open"
+)
+
+// breaker is a circuit breaker. It opens after a number of consecutive
+// failures, refusing calls until the open duration elapses. It then lets a
+// single trial call through, closing again if it succeeds and reopening if
+// it fails.
+type breaker struct {
+	failureThreshold int
+	openDuration     time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	// trial is set while the trial call of a half-open breaker is in flight
+	trial bool
+}
+
+// newBreaker creates a closed circuit breaker
+func newBreaker(failureThreshold int, openDuration time.Duration) *breaker {
+	b := &breaker{
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+	}
+	b.setState(StateClosed)
+	return b
+}
+
+// State returns the current state of the breaker
+func (b *breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.openDuration {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Allow reports whether a call may be made, returning ErrCircuitOpen if not.
+// Every allowed call must be followed by Record or Skip.
+func (b *breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.openDuration {
+			return ErrCircuitOpen
+		}
+		b.setState(StateHalfOpen)
+		b.trial = true
+		return nil
+	case StateHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record records the outcome of an allowed call
+func (b *breaker) Record(healthy bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if healthy {
+		b.failures = 0
+		if b.state != StateClosed {
+			b.setState(StateClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.failureThreshold {
+		b.openedAt = time.Now()
+		b.setState(StateOpen)
+	}
+}
+
+// Skip ends an allowed call whose outcome says nothing about the health of
+// the provider, such as a call cancelled by the caller
+func (b *breaker) Skip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+// setState sets the state and exposes it as a metric
+func (b *breaker) setState(state string) {
+	b.state = state
+	for _, s := range []string{StateClosed, StateHalfOpen, StateOpen} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		metrics.UpstreamCircuitState.WithLabelValues(Provider, s).Set(value)
+	}
+}
@@ -1,12 +1,30 @@
 package weather
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
+	// Embed the time zone database so location time zones resolve in minimal containers
+	_ "time/tzdata"
 
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/logging"
+	"github.com/kevinmahoney/etrenank/internal/metrics"
 	"github.com/kevinmahoney/etrenank/internal/models"
+	"github.com/kevinmahoney/etrenank/internal/services/quota"
+	"github.com/kevinmahoney/etrenank/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Client represents a weather API client
@@ -14,6 +32,12 @@ type Client struct {
 	apiKey     string
 	httpClient *http.Client
 	baseURL    string
+
+	maxRetries     int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+	breaker        *breaker
+	quota          *quota.Tracker
 }
 
 // WeatherAPIResponse represents the response from WeatherAPI.com
@@ -24,6 +48,7 @@ type WeatherAPIResponse struct {
 		Country        string  `json:"country"`
 		Lat            float64 `json:"lat"`
 		Lon            float64 `json:"lon"`
+		TzID           string  `json:"tz_id"`
 		LocaltimeEpoch int64   `json:"localtime_epoch"`
 		Localtime      string  `json:"localtime"`
 	} `json:"location"`
@@ -76,35 +101,285 @@ type WeatherAPIResponse struct {
 			MoonIllumination string `json:"moon_illumination"`
 		} `json:"astro"`
 	} `json:"astronomy"`
+	Forecast struct {
+		Forecastday []struct {
+			Date  string `json:"date"`
+			Astro struct {
+				Sunrise          string `json:"sunrise"`
+				Sunset           string `json:"sunset"`
+				Moonrise         string `json:"moonrise"`
+				Moonset          string `json:"moonset"`
+				MoonPhase        string `json:"moon_phase"`
+				MoonIllumination string `json:"moon_illumination"`
+			} `json:"astro"`
+		} `json:"forecastday"`
+	} `json:"forecast"`
 }
 
-// NewClient creates a new weather API client
-func NewClient(apiKey string) *Client {
+// NewClient creates a new weather API client. Calls are counted and kept
+// within budget by the quota tracker.
+func NewClient(cfg config.WeatherConfig, quotaTracker *quota.Tracker) *Client {
 	return &Client{
-		apiKey: apiKey,
+		apiKey: cfg.APIKey,
 		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout: cfg.Timeout,
 		},
-		baseURL: "https://api.weatherapi.com/v1",
+		baseURL: cfg.BaseURL,
+		maxRetries:     cfg.MaxRetries,
+		retryBaseDelay: cfg.RetryBaseDelay,
+		retryMaxDelay:  cfg.RetryMaxDelay,
+		breaker:        newBreaker(cfg.BreakerFailures, cfg.BreakerOpenDuration),
+		quota:          quotaTracker,
 	}
 }
 
+// Available reports an error if requests to the weather provider are
+// currently refused by the circuit breaker
+func (c *Client) Available() error {
+	if c.breaker.State() == StateOpen {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// CircuitState returns the state of the circuit breaker: closed, half-open or open
+func (c *Client) CircuitState() string {
+	return c.breaker.State()
+}
+
+// Provider is the name of the weather provider used by the client
+const Provider = "weatherapi"
+
+// zipPlus4Pattern matches a US ZIP+4 code
+var zipPlus4Pattern = regexp.MustCompile(`^(\d{5})-\d{4}$`)
+
+// NormalizeLocation normalizes a location query so that equivalent queries
+// share cache entries: surrounding whitespace is trimmed, inner whitespace
+// collapsed, letters upper-cased and US ZIP+4 codes reduced to the ZIP code
+func NormalizeLocation(location string) string {
+	normalized := strings.ToUpper(strings.Join(strings.Fields(location), " "))
+	return zipPlus4Pattern.ReplaceAllString(normalized, "$1")
+}
+
+// MaxLocationLength is the length, in bytes, of the longest location query
+// accepted, which fits the column saved locations are stored in
+const MaxLocationLength = 32
+
+// locationPattern matches the normalized location queries accepted: ZIP and
+// postal codes, place names and latitude,longitude coordinates
+var locationPattern = regexp.MustCompile(`^-?[\p{L}\d][\p{L}\d ,.'-]*$`)
+
+// ValidLocation reports whether a normalized location query is well-formed
+// and short enough to be looked up and saved
+func ValidLocation(location string) bool {
+	return len(location) <= MaxLocationLength && locationPattern.MatchString(location)
+}
+
 // GetWeatherByZipCode fetches weather data for a specific zip code
-func (c *Client) GetWeatherByZipCode(zipCode string) (*models.WeatherData, *models.AstronomyData, error) {
-	url := fmt.Sprintf("%s/forecast.json?key=%s&q=%s&aqi=yes&alerts=no&days=1", c.baseURL, c.apiKey, zipCode)
-	
-	resp, err := c.httpClient.Get(url)
+func (c *Client) GetWeatherByZipCode(ctx context.Context, zipCode string) (*models.WeatherData, *models.AstronomyData, error) {
+	raw, err := c.FetchForecast(ctx, zipCode)
 	if err != nil {
 		return nil, nil, err
 	}
+
+	return ParseForecast(raw)
+}
+
+// FetchForecast fetches the raw forecast response for a specific zip code.
+// Transient failures are retried with jittered exponential backoff, or after
+// the delay requested by the provider when rate limited. The request is
+// abandoned when ctx is cancelled, and refused with ErrCircuitOpen while the
+// provider is considered unhealthy, or with quota.ErrBudgetExhausted once its
+// call budget is nearly spent.
+func (c *Client) FetchForecast(ctx context.Context, zipCode string) (forecast []byte, err error) {
+	ctx, span := tracing.Start(ctx, "weather.fetch_forecast",
+		attribute.String("provider", Provider), attribute.String("location", zipCode))
+	defer func() { tracing.End(span, err) }()
+
+	requestURL := fmt.Sprintf("%s/forecast.json?key=%s&q=%s&aqi=yes&alerts=no&days=2", c.baseURL, c.apiKey, url.QueryEscape(zipCode))
+
+	for attempt := 0; ; attempt++ {
+		span.SetAttributes(attribute.Int("weather.attempts", attempt+1))
+
+		forecast, err = c.fetch(ctx, requestURL)
+		var transient *transientError
+		if err == nil || !errors.As(err, &transient) || attempt >= c.maxRetries {
+			return forecast, err
+		}
+
+		delay, ok := c.retryDelay(attempt, transient.retryAfter)
+		if !ok {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, err
+		}
+
+		metrics.UpstreamRetries.WithLabelValues(Provider, transient.reason).Inc()
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// transientError is a failure of the weather provider that may not happen
+// again if the request is retried
+type transientError struct {
+	err    error
+	reason string
+	// retryAfter is the delay requested by the provider before retrying, if any
+	retryAfter time.Duration
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transientError) Unwrap() error {
+	return e.err
+}
+
+// fetch makes a single request to the weather provider, recording its
+// outcome in the circuit breaker and counting it against the call budget
+func (c *Client) fetch(ctx context.Context, requestURL string) ([]byte, error) {
+	reservation, err := c.quota.Reserve(ctx)
+	if err != nil {
+		metrics.UpstreamErrors.WithLabelValues(Provider, "budget_exhausted").Inc()
+		return nil, err
+	}
+	if err := c.breaker.Allow(); err != nil {
+		reservation.Release(ctx)
+		metrics.UpstreamErrors.WithLabelValues(Provider, "circuit_open").Inc()
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		reservation.Release(ctx)
+		c.breaker.Skip()
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		reason := transportErrorReason(err)
+		metrics.UpstreamRequestDuration.WithLabelValues(Provider, "error").Observe(time.Since(start).Seconds())
+		metrics.UpstreamErrors.WithLabelValues(Provider, reason).Inc()
+
+		// The request URL carries the API key, so it must not end up in errors or spans
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, c.transportFailure(ctx, fmt.Errorf("weather API request failed: %v", err), reason)
+	}
 	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		return nil, nil, fmt.Errorf("weather API returned status code %d", resp.StatusCode)
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	logging.Set(ctx, logging.FieldUpstreamLatency, time.Since(start).Milliseconds())
+
+	body, err := io.ReadAll(resp.Body)
+	metrics.UpstreamRequestDuration.WithLabelValues(Provider, strconv.Itoa(resp.StatusCode)).Observe(time.Since(start).Seconds())
+
+	statusErr := fmt.Errorf("weather API returned status code %d", resp.StatusCode)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		metrics.UpstreamErrors.WithLabelValues(Provider, "rate_limited").Inc()
+		c.breaker.Record(false)
+		return nil, &transientError{err: statusErr, reason: "rate_limited", retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	case resp.StatusCode >= http.StatusInternalServerError:
+		metrics.UpstreamErrors.WithLabelValues(Provider, "status").Inc()
+		c.breaker.Record(false)
+		return nil, &transientError{err: statusErr, reason: "status"}
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusNotFound:
+		// The provider is healthy but rejected the request, for instance
+		// because the location is unknown
+		metrics.UpstreamErrors.WithLabelValues(Provider, "status").Inc()
+		c.breaker.Record(true)
+		return nil, statusErr
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		// A revoked API key or a blocked quota fails every request until
+		// fixed, so it counts against the provider without being retried
+		metrics.UpstreamErrors.WithLabelValues(Provider, "unauthorized").Inc()
+		c.breaker.Record(false)
+		return nil, statusErr
+	case resp.StatusCode != http.StatusOK:
+		metrics.UpstreamErrors.WithLabelValues(Provider, "status").Inc()
+		c.breaker.Record(false)
+		return nil, statusErr
 	}
-	
+	if err != nil {
+		reason := transportErrorReason(err)
+		metrics.UpstreamErrors.WithLabelValues(Provider, reason).Inc()
+		return nil, c.transportFailure(ctx, err, reason)
+	}
+
+	c.breaker.Record(true)
+	return body, nil
+}
+
+// transportFailure records a request that failed before a full response was
+// received. Requests abandoned by the caller say nothing about the provider,
+// so they are neither counted by the circuit breaker nor retried.
+func (c *Client) transportFailure(ctx context.Context, err error, reason string) error {
+	if ctx.Err() != nil {
+		c.breaker.Skip()
+		return err
+	}
+
+	c.breaker.Record(false)
+	return &transientError{err: err, reason: reason}
+}
+
+// retryDelay returns how long to wait before retrying a request that failed
+// the given number of times. A delay requested by the provider is honored
+// unless it exceeds the maximum delay, in which case ok is false.
+func (c *Client) retryDelay(attempt int, retryAfter time.Duration) (delay time.Duration, ok bool) {
+	if retryAfter > 0 {
+		return retryAfter, retryAfter <= c.retryMaxDelay
+	}
+
+	delay = c.retryBaseDelay << attempt
+	if delay <= 0 || delay > c.retryMaxDelay {
+		delay = c.retryMaxDelay
+	}
+	// Full jitter spreads out the retries of requests that failed together
+	return time.Duration(rand.Int63n(int64(delay))) + 1, true
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP
+// date, returning zero if it is missing or invalid
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && time.Until(at) > 0 {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// transportErrorReason classifies an error that prevented a response from being received
+func transportErrorReason(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), os.IsTimeout(err):
+		return "timeout"
+	default:
+		return "transport"
+	}
+}
+
+// ParseForecast extracts weather and astronomy data from a raw forecast response
+func ParseForecast(raw []byte) (*models.WeatherData, *models.AstronomyData, error) {
 	var apiResp WeatherAPIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+	if err := json.Unmarshal(raw, &apiResp); err != nil {
 		return nil, nil, err
 	}
 	
@@ -125,6 +400,10 @@ func (c *Client) GetWeatherByZipCode(zipCode string) (*models.WeatherData, *mode
 	
 	// Get precipitation for last 24h (this is an approximation from current data)
 	weatherData.PrecipitationLast24h = apiResp.Current.PrecipMm
+
+	if apiResp.Current.LastUpdatedEpoch > 0 {
+		weatherData.ObservedAt = time.Unix(apiResp.Current.LastUpdatedEpoch, 0).UTC()
+	}
 	
 	// Extract astronomy data
 	// We need to calculate sun altitude based on time of day and location
@@ -152,6 +431,46 @@ func (c *Client) GetWeatherByZipCode(zipCode string) (*models.WeatherData, *mode
 		MoonPhase:         apiResp.Astronomy.Astro.MoonPhase,
 		MoonIllumination:  moonIllumination,
 	}
+
+	// The forecast endpoint reports astronomy per forecast day
+	if days := apiResp.Forecast.Forecastday; len(days) > 0 && astronomyData.SunriseTime == "" {
+		astro := days[0].Astro
+		fmt.Sscanf(astro.MoonIllumination, "%f", &astronomyData.MoonIllumination)
+		astronomyData.SunriseTime = astro.Sunrise
+		astronomyData.SunsetTime = astro.Sunset
+		astronomyData.MoonPhase = astro.MoonPhase
+	}
+
+	astronomyData.SunEvents = parseSunEvents(apiResp)
 	
 	return weatherData, astronomyData, nil
 }
+
+// parseSunEvents converts the local sunrise and sunset times of each
+// forecast day to absolute times. Days or events the provider reports
+// without a time, such as polar days, are skipped.
+func parseSunEvents(apiResp WeatherAPIResponse) []models.SunEvent {
+	loc, err := time.LoadLocation(apiResp.Location.TzID)
+	if err != nil {
+		return nil
+	}
+
+	var events []models.SunEvent
+	for _, day := range apiResp.Forecast.Forecastday {
+		for _, event := range []struct {
+			eventType string
+			localTime string
+		}{
+			{models.SunEventSunrise, day.Astro.Sunrise},
+			{models.SunEventSunset, day.Astro.Sunset},
+		} {
+			t, err := time.ParseInLocation("2006-01-02 03:04 PM", day.Date+" "+event.localTime, loc)
+			if err != nil {
+				continue
+			}
+			events = append(events, models.SunEvent{Type: event.eventType, Time: t.UTC()})
+		}
+	}
+
+	return events
+}
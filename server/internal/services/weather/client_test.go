@@ -0,0 +1,58 @@
+package weather
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/services/cache"
+	"github.com/kevinmahoney/etrenank/internal/services/quota"
+)
+
+func TestFetchForecastBreaker(t *testing.T) {
+	tests := []struct {
+		status int
+		state  string
+	}{
+		{http.StatusBadRequest, StateClosed},
+		{http.StatusNotFound, StateClosed},
+		{http.StatusUnauthorized, StateOpen},
+		{http.StatusForbidden, StateOpen},
+		{http.StatusTooManyRequests, StateOpen},
+		{http.StatusInternalServerError, StateOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "rejected", tt.status)
+			}))
+			defer provider.Close()
+
+			store := cache.NewMemoryStore()
+			defer store.Close()
+
+			client := NewClient(config.WeatherConfig{
+				APIKey:              "test",
+				BaseURL:             provider.URL,
+				Timeout:             5 * time.Second,
+				RetryBaseDelay:      time.Millisecond,
+				RetryMaxDelay:       time.Millisecond,
+				BreakerFailures:     2,
+				BreakerOpenDuration: time.Minute,
+			}, quota.NewTracker(Provider, config.QuotaConfig{WarnRatio: 0.8, CacheOnlyRatio: 0.95}, store))
+
+			for i := 0; i < 2; i++ {
+				if _, err := client.FetchForecast(context.Background(), "10001"); err == nil {
+					t.Fatalf("request %d: got no error for status %d", i+1, tt.status)
+				}
+			}
+			if state := client.CircuitState(); state != tt.state {
+				t.Errorf("got circuit %s, want %s", state, tt.state)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/kevinmahoney/etrenank/internal/config"
+	"github.com/kevinmahoney/etrenank/internal/db"
+	"github.com/kevinmahoney/etrenank/internal/metrics"
+)
+
+// settleDelay is how long file changes must stop before the file is
+// reloaded, since editors and deployments usually write it in several steps
+const settleDelay = 250 * time.Millisecond
+
+// Manager holds the current runtime settings and reloads them from their
+// sources: the defaults, then the settings file, then the runtime_settings
+// table. New settings are validated as a whole and swapped in atomically;
+// invalid settings are rejected and the current ones kept.
+type Manager struct {
+	config config.RuntimeConfig
+	repo   db.SettingsRepository
+
+	current atomic.Pointer[Settings]
+	// reloadMu serializes reloads
+	reloadMu sync.Mutex
+}
+
+// NewManager creates a runtime settings manager and loads the settings. The
+// repository is only read if the database is enabled as a source.
+func NewManager(cfg config.RuntimeConfig, repo db.SettingsRepository) (*Manager, error) {
+	m := &Manager{config: cfg}
+	if cfg.Database {
+		m.repo = repo
+	}
+
+	settings, err := m.load(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	m.current.Store(settings)
+	return m, nil
+}
+
+// Current returns the current settings, which must not be modified
+func (m *Manager) Current() *Settings {
+	return m.current.Load()
+}
+
+// Reload reloads the settings from their sources. If they are invalid or
+// cannot be read, the current settings are kept and the error returned.
+func (m *Manager) Reload(ctx context.Context, trigger string) error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	settings, err := m.load(ctx)
+	if err != nil {
+		metrics.SettingsReloads.WithLabelValues("failure").Inc()
+		slog.ErrorContext(ctx, "Failed to reload runtime settings, keeping the current settings", "trigger", trigger, "error", err)
+		return err
+	}
+
+	if reflect.DeepEqual(settings, m.Current()) {
+		return nil
+	}
+
+	m.current.Store(settings)
+	metrics.SettingsReloads.WithLabelValues("success").Inc()
+	slog.InfoContext(ctx, "Reloaded runtime settings", "trigger", trigger,
+		"scoring_version", settings.Scoring.Version(),
+		"rate_limit_overrides", len(settings.RateLimits),
+		"features", len(settings.Features))
+	return nil
+}
+
+// load reads the settings from every source and validates them
+func (m *Manager) load(ctx context.Context) (*Settings, error) {
+	settings := Defaults()
+
+	if m.config.File != "" {
+		format, err := FormatOf(m.config.File)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(m.config.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read runtime settings file: %v", err)
+		}
+		if err := Decode(data, format, settings); err != nil {
+			return nil, fmt.Errorf("invalid runtime settings file %s: %v", m.config.File, err)
+		}
+	}
+
+	if m.repo != nil {
+		document, err := m.repo.GetRuntimeSettings(ctx)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return nil, fmt.Errorf("failed to read runtime settings from the database: %v", err)
+		default:
+			// The document is stored as JSON, which decodes as YAML
+			if err := Decode([]byte(document), FormatYAML, settings); err != nil {
+				return nil, fmt.Errorf("invalid runtime settings in the database: %v", err)
+			}
+		}
+	}
+
+	if err := settings.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid runtime settings: %v", err)
+	}
+	return settings, nil
+}
+
+// Run reloads the settings on SIGHUP, when the settings file changes and, if
+// the database is a source, every poll interval, until ctx is cancelled
+func (m *Manager) Run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var fileEvents <-chan fsnotify.Event
+	var watchErrors <-chan error
+	if m.config.File != "" {
+		watcher, err := m.watch()
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to watch runtime settings file, reload it with SIGHUP", "file", m.config.File, "error", err)
+		} else {
+			defer watcher.Close()
+			fileEvents, watchErrors = watcher.Events, watcher.Errors
+		}
+	}
+
+	var poll <-chan time.Time
+	if m.repo != nil {
+		ticker := time.NewTicker(m.config.PollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	settled := time.NewTimer(settleDelay)
+	settled.Stop()
+	defer settled.Stop()
+
+	for {
+		select {
+		case <-hangup:
+			m.Reload(ctx, "signal")
+		case <-poll:
+			m.Reload(ctx, "poll")
+		case event := <-fileEvents:
+			if m.affectsFile(event) {
+				settled.Reset(settleDelay)
+			}
+		case <-settled.C:
+			m.Reload(ctx, "file")
+		case err := <-watchErrors:
+			slog.WarnContext(ctx, "Error watching runtime settings file", "file", m.config.File, "error", err)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// watch watches the directory of the settings file rather than the file
+// itself, so that a file replaced by a rename, as editors and Kubernetes
+// config maps do, is still watched
+func (m *Manager) watch() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(m.config.File)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+// affectsFile reports whether a change in the watched directory may change
+// the settings file. Kubernetes updates config maps by swapping the ..data
+// symlink that the file resolves through.
+func (m *Manager) affectsFile(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	name := filepath.Base(event.Name)
+	return name == filepath.Base(m.config.File) || name == "..data"
+}
@@ -0,0 +1,157 @@
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kevinmahoney/etrenank/internal/models"
+	"github.com/kevinmahoney/etrenank/internal/photoquality"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings are the settings that may change while the API is running. A
+// Settings value is never modified once loaded, so it may be shared.
+type Settings struct {
+	// Scoring weights the factors of the sunset quality score
+	Scoring photoquality.Weights `yaml:"scoring" toml:"scoring"`
+	// RateLimits overrides the rate limit per minute of applications by
+	// client ID; zero means unlimited
+	RateLimits map[string]int `yaml:"rate_limits" toml:"rate_limits"`
+	// Features enables or disables features for every application
+	Features map[string]bool `yaml:"features" toml:"features"`
+}
+
+// Defaults returns the settings used where no source sets them
+func Defaults() *Settings {
+	return &Settings{
+		Scoring:    photoquality.DefaultWeights(),
+		RateLimits: make(map[string]int),
+		Features:   make(map[string]bool),
+	}
+}
+
+// Validate checks the settings, reporting every problem at once
+func (s *Settings) Validate() error {
+	var problems []string
+	if err := s.Scoring.Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("scoring: %v", err))
+	}
+	for clientID, limit := range s.RateLimits {
+		if limit < 0 {
+			problems = append(problems, fmt.Sprintf("rate_limits: limit of %q must not be negative", clientID))
+		}
+	}
+	for name := range s.Features {
+		if !models.ValidFeatureName(name) {
+			problems = append(problems, fmt.Sprintf("features: invalid feature name %q", name))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	// Map iteration order is random, so problems are sorted to be reported consistently
+	sort.Strings(problems)
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// RateLimit returns the rate limit per minute of an application, which the
+// settings may override
+func (s *Settings) RateLimit(clientID string, configured int) int {
+	if limit, ok := s.RateLimits[clientID]; ok {
+		return limit
+	}
+	return configured
+}
+
+// Feature reports whether the settings enable or disable a feature for every
+// application, and whether they set it at all
+func (s *Settings) Feature(name string) (enabled, ok bool) {
+	enabled, ok = s.Features[name]
+	return enabled, ok
+}
+
+// Formats
+const (
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// FormatOf returns the format of a settings file from its extension. JSON
+// files are read as YAML, of which JSON is a subset.
+func FormatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	default:
+		return "", fmt.Errorf("unsupported settings file %s: must be .yaml, .yml, .json or .toml", path)
+	}
+}
+
+// Decode decodes a settings document over s, so that settings missing from
+// the document keep their value. Unknown settings are rejected.
+func Decode(data []byte, format string, s *Settings) error {
+	switch format {
+	case FormatYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		// An empty document decodes to io.EOF and leaves the settings as is
+		if err := decoder.Decode(s); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	case FormatTOML:
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(s)
+	default:
+		return fmt.Errorf("unknown settings format %q", format)
+	}
+}
+
+// Parse decodes and validates a settings document over the defaults
+func Parse(data []byte, format string) (*Settings, error) {
+	s := Defaults()
+	if err := Decode(data, format, s); err != nil {
+		return nil, err
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ToJSON converts a valid settings document to JSON, as stored in the
+// runtime_settings table. Only the settings present in the document are kept,
+// so that the others keep their value from the settings file.
+func ToJSON(data []byte, format string) (string, error) {
+	if _, err := Parse(data, format); err != nil {
+		return "", err
+	}
+
+	values := make(map[string]interface{})
+	var err error
+	if format == FormatTOML {
+		err = toml.Unmarshal(data, &values)
+	} else {
+		err = yaml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	document, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(document), nil
+}
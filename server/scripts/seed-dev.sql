@@ -0,0 +1,16 @@
+-- Sample application for local development, which scripts/init-db.sql used to
+-- create. Never load it into a shared database: its secret is public.
+--
+-- Run it once the schema is migrated:
+--   etrenankctl migrate up
+--   psql -h localhost -U postgres -f scripts/seed-dev.sql
+
+INSERT INTO applications (id, client_id)
+VALUES
+    ('00000000-0000-0000-0000-000000000001', 'test_client')
+ON CONFLICT (id) DO NOTHING;
+
+INSERT INTO application_secrets (id, application_id, secret)
+VALUES
+    ('00000000-0000-0000-0000-000000000001', '00000000-0000-0000-0000-000000000001', 'test_secret')
+ON CONFLICT (id) DO NOTHING;